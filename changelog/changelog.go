@@ -25,6 +25,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -138,6 +141,38 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 	return &changeLog, nil
 }
 
+// closesRegexp matches bug closing commands, as defined in Debian Policy,
+// section 4.4, entitled "Debian changelog: debian/changelog".
+var closesRegexp = regexp.MustCompile(
+	`(?i)closes:\s*(?:bug)?#?\s?\d+(?:,\s*(?:bug)?#?\s?\d+)*`,
+)
+
+var bugRegexp = regexp.MustCompile(`\d+`)
+
+// Closes returns the bug numbers closed by this changelog entry, in
+// ascending order, as written to the Closes field of a .changes file.
+func (entry ChangelogEntry) Closes() []string {
+	seen := map[int]bool{}
+	bugs := []int{}
+	for _, closes := range closesRegexp.FindAllString(entry.Changelog, -1) {
+		for _, bug := range bugRegexp.FindAllString(closes, -1) {
+			number, err := strconv.Atoi(bug)
+			if err != nil || seen[number] {
+				continue
+			}
+			seen[number] = true
+			bugs = append(bugs, number)
+		}
+	}
+	sort.Ints(bugs)
+
+	ret := []string{}
+	for _, bug := range bugs {
+		ret = append(ret, strconv.Itoa(bug))
+	}
+	return ret
+}
+
 func ParseFileOne(path string) (*ChangelogEntry, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -99,4 +99,19 @@ func TestChangelogEntries(t *testing.T) {
 	assert(t, len(changeLogs) == 2)
 }
 
+func TestChangelogCloses(t *testing.T) {
+	changeLogs, err := changelog.Parse(strings.NewReader(changeLog))
+	isok(t, err)
+	assert(t, len(changeLogs[0].Closes()) == 0)
+
+	closes := changeLogs[1].Closes()
+	assert(t, len(closes) == 1 && closes[0] == "767172")
+
+	changeLogs[1].Changelog = "  * Fix things. (Closes: #12, bug#9,#12)\n" +
+		"  * More fixes. closes: 100\n"
+	closes = changeLogs[1].Closes()
+	assert(t, len(closes) == 3)
+	assert(t, closes[0] == "9" && closes[1] == "12" && closes[2] == "100")
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,266 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+)
+
+// Autopkgtest {{{
+
+// An Autopkgtest is a single stanza of a debian/tests/control file, as
+// defined by the autopkgtest specification (README.package-tests). Each
+// stanza either names test scripts to run from the Tests-Directory, or
+// gives a shell command to run as the test with Test-Command.
+type Autopkgtest struct {
+	Paragraph
+
+	Tests          []string `delim:" " fields:"true"`
+	TestCommand    string   `control:"Test-Command"`
+	Depends        string   `omitempty:"true"`
+	Restrictions   []string `delim:", " fields:"true"`
+	Features       []string `delim:", " fields:"true"`
+	Classes        []string `delim:", " fields:"true"`
+	Architecture   []string `delim:" " fields:"true"`
+	TestsDirectory string   `control:"Tests-Directory"`
+
+	// Name of a Test-Command stanza, which has no name of its own. It's
+	// set by ParseAutopkgtests the same way autopkgtest names it, by
+	// counting the Test-Command stanzas in the file ("command1",
+	// "command2", ...).
+	CommandName string `control:"-"`
+}
+
+// Return the names of the tests defined by this stanza.
+func (a Autopkgtest) Names() []string {
+	if a.TestCommand != "" {
+		return []string{a.CommandName}
+	}
+	return a.Tests
+}
+
+// Return the paths of the test scripts this stanza runs, relative to the
+// root of the source tree. A Test-Command stanza has no scripts.
+func (a Autopkgtest) TestPaths() []string {
+	ret := []string{}
+	for _, test := range a.Tests {
+		ret = append(ret, path.Join(a.TestsDirectory, test))
+	}
+	return ret
+}
+
+// Check to see if this stanza has the given Restriction, such as
+// "needs-root" or "isolation-container".
+func (a Autopkgtest) HasRestriction(restriction string) bool {
+	for _, el := range a.Restrictions {
+		if el == restriction {
+			return true
+		}
+	}
+	return false
+}
+
+// Check to see if the tests in this stanza should be run on the given
+// Architecture. Architectures prefixed with a "!" exclude the test from
+// running on that Architecture, and if any Architecture is listed without
+// a "!", the tests only run on the Architectures listed.
+func (a Autopkgtest) RunsOn(arch dependency.Arch) bool {
+	included := false
+	restricted := false
+	for _, el := range a.Architecture {
+		negated := strings.HasPrefix(el, "!")
+		if !negated {
+			restricted = true
+		}
+		candidate, err := dependency.ParseArch(strings.TrimPrefix(el, "!"))
+		if err != nil {
+			continue
+		}
+		if candidate.CPU == "all" || candidate.Is(&arch) {
+			if negated {
+				return false
+			}
+			included = true
+		}
+	}
+	return included || !restricted
+}
+
+// Return the Depends of this stanza, with the placeholders the autopkgtest
+// specification allows expanded against the given source package:
+//
+//	"@" is every binary package built by the source on the given
+//	Architecture (udebs are skipped, since they can't be installed);
+//
+//	"@builddeps@" is the Build-Depends, Build-Depends-Arch and
+//	Build-Depends-Indep of the source, along with build-essential;
+//
+//	"@recommends@" is the Recommends of every binary package built by the
+//	source on the given Architecture.
+//
+// If Depends isn't set, it defaults to "@". Any relations which still
+// contain substitution variables (such as "${shlibs:Depends}") are dropped,
+// since they're only known once the package has been built.
+func (a Autopkgtest) GetDepends(source Control, arch dependency.Arch) (*dependency.Dependency, error) {
+	depends := a.Depends
+	if strings.TrimSpace(depends) == "" {
+		depends = "@"
+	}
+
+	binaries := []BinaryParagraph{}
+	for _, binary := range source.Binaries {
+		if binary.Values["Package-Type"] == "udeb" || !binaryBuildsOn(binary, arch) {
+			continue
+		}
+		binaries = append(binaries, binary)
+	}
+
+	relations := []string{}
+	for _, relation := range splitRelations(depends) {
+		switch relation {
+		case "@":
+			for _, binary := range binaries {
+				relations = append(relations, binary.Package)
+			}
+		case "@builddeps@":
+			for _, field := range []string{
+				"Build-Depends",
+				"Build-Depends-Arch",
+				"Build-Depends-Indep",
+			} {
+				relations = append(relations, splitRelations(source.Source.Values[field])...)
+			}
+			relations = append(relations, "build-essential")
+		case "@recommends@":
+			for _, binary := range binaries {
+				relations = append(relations, splitRelations(binary.Values["Recommends"])...)
+			}
+		default:
+			relations = append(relations, relation)
+		}
+	}
+
+	ret := []string{}
+	for _, relation := range relations {
+		if strings.Contains(relation, "${") {
+			continue
+		}
+		ret = append(ret, relation)
+	}
+	return dependency.Parse(strings.Join(ret, ", "))
+}
+
+// Split a relationship field on commas, returning each relation with the
+// surrounding whitespace removed, and skipping any empty relations (such
+// as the one after a trailing comma).
+func splitRelations(value string) []string {
+	ret := []string{}
+	for _, relation := range strings.Split(value, ",") {
+		relation = strings.Join(strings.Fields(relation), " ")
+		if relation == "" {
+			continue
+		}
+		ret = append(ret, relation)
+	}
+	return ret
+}
+
+// Check to see if the binary package is built on the given Architecture.
+func binaryBuildsOn(binary BinaryParagraph, arch dependency.Arch) bool {
+	if len(binary.Architectures) == 0 {
+		return true
+	}
+	for _, el := range binary.Architectures {
+		if el.CPU == "all" || el.Is(&arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// }}}
+
+// Parsing {{{
+
+// Given a path on the filesystem, Parse the debian/tests/control file off
+// the disk and return the stanzas it contains, unless error is set to a
+// value other than nil.
+func ParseAutopkgtestFile(path string) (ret []Autopkgtest, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseAutopkgtests(bufio.NewReader(f))
+}
+
+// Given an io.Reader, consume the Reader, and return the stanzas of the
+// debian/tests/control file it contains. Each stanza must set exactly one
+// of Tests or Test-Command, and Test-Command stanzas are given their
+// CommandName. If Tests-Directory isn't set, it defaults to "debian/tests".
+func ParseAutopkgtests(reader io.Reader) ([]Autopkgtest, error) {
+	decoder, err := NewDecoder(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Autopkgtest{}
+	if err := decoder.Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	commands := 0
+	for i := range ret {
+		test := &ret[i]
+		if (len(test.Tests) == 0) == (test.TestCommand == "") {
+			return nil, fmt.Errorf(
+				"Test stanza %d must have exactly one of Tests or Test-Command",
+				i+1,
+			)
+		}
+		if test.TestCommand != "" {
+			commands++
+			test.CommandName = fmt.Sprintf("command%d", commands)
+		}
+		if test.TestsDirectory == "" {
+			test.TestsDirectory = "debian/tests"
+		}
+	}
+	return ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
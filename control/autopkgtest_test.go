@@ -0,0 +1,167 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+// Test Autopkgtest {{{
+const testAutopkgtestControl = `Source: hello
+Build-Depends: debhelper-compat (= 13),
+ libfoo-dev
+Build-Depends-Indep: python3-sphinx
+
+Package: hello
+Architecture: any
+Depends: ${shlibs:Depends}, ${misc:Depends}
+Recommends: hello-doc, ${misc:Recommends}
+
+Package: hello-doc
+Architecture: all
+
+Package: hello-udeb
+Package-Type: udeb
+Architecture: any
+
+Package: hello-win32
+Architecture: i386
+`
+
+const testAutopkgtests = `# A comment
+Tests: smoke, upgrade
+ unicode
+Restrictions: allow-stderr needs-root,isolation-container
+
+Test-Command: hello --version
+Depends: @, python3 (>= 3.9), ${misc:Depends},
+Features: test-name=version
+Architecture: amd64 arm64
+
+Tests: build
+Depends: @builddeps@, @recommends@
+Tests-Directory: tests
+Architecture: !i386
+
+Test-Command: hello --help
+`
+
+func TestParseAutopkgtests(t *testing.T) {
+	tests, err := control.ParseAutopkgtests(strings.NewReader(testAutopkgtests))
+	isok(t, err)
+	assert(t, len(tests) == 4)
+
+	assert(t, len(tests[0].Tests) == 3)
+	assert(t, tests[0].Tests[2] == "unicode")
+	assert(t, len(tests[0].Restrictions) == 3)
+	assert(t, tests[0].HasRestriction("needs-root"))
+	assert(t, tests[0].HasRestriction("isolation-container"))
+	assert(t, !tests[0].HasRestriction("breaks-testbed"))
+	assert(t, tests[0].TestsDirectory == "debian/tests")
+	assert(t, tests[0].TestPaths()[1] == "debian/tests/upgrade")
+	assert(t, tests[0].Names()[0] == "smoke")
+
+	assert(t, tests[1].TestCommand == "hello --version")
+	assert(t, len(tests[1].TestPaths()) == 0)
+	assert(t, tests[1].Names()[0] == "command1")
+	assert(t, tests[1].Features[0] == "test-name=version")
+
+	assert(t, tests[2].TestPaths()[0] == "tests/build")
+	assert(t, tests[2].CommandName == "")
+
+	/* Test-Command stanzas are numbered among themselves */
+	assert(t, tests[3].Names()[0] == "command2")
+
+	_, err = control.ParseAutopkgtests(strings.NewReader(`Tests: foo
+Test-Command: true
+`))
+	notok(t, err)
+
+	_, err = control.ParseAutopkgtests(strings.NewReader(`Restrictions: needs-root
+`))
+	notok(t, err)
+}
+
+func TestAutopkgtestRunsOn(t *testing.T) {
+	tests, err := control.ParseAutopkgtests(strings.NewReader(testAutopkgtests))
+	isok(t, err)
+
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	i386, err := dependency.ParseArch("i386")
+	isok(t, err)
+
+	assert(t, tests[0].RunsOn(*amd64))
+	assert(t, tests[0].RunsOn(*i386))
+	assert(t, tests[1].RunsOn(*amd64))
+	assert(t, !tests[1].RunsOn(*i386))
+	assert(t, tests[2].RunsOn(*amd64))
+	assert(t, !tests[2].RunsOn(*i386))
+}
+
+func TestAutopkgtestGetDepends(t *testing.T) {
+	source, err := control.ParseControl(
+		bufio.NewReader(strings.NewReader(testAutopkgtestControl)),
+		"",
+	)
+	isok(t, err)
+	tests, err := control.ParseAutopkgtests(strings.NewReader(testAutopkgtests))
+	isok(t, err)
+
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	names := func(depends *dependency.Dependency) []string {
+		ret := []string{}
+		for _, relation := range depends.Relations {
+			ret = append(ret, relation.Possibilities[0].Name)
+		}
+		return ret
+	}
+
+	/* Depends defaults to "@" */
+	depends, err := tests[0].GetDepends(*source, *amd64)
+	isok(t, err)
+	assert(t, strings.Join(names(depends), " ") == "hello hello-doc")
+
+	depends, err = tests[1].GetDepends(*source, *amd64)
+	isok(t, err)
+	assert(t, strings.Join(names(depends), " ") == "hello hello-doc python3")
+	assert(t, depends.Relations[2].Possibilities[0].Version.Number == "3.9")
+
+	depends, err = tests[2].GetDepends(*source, *amd64)
+	isok(t, err)
+	assert(t, strings.Join(names(depends), " ") ==
+		"debhelper-compat libfoo-dev python3-sphinx build-essential hello-doc")
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,100 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"pault.ag/go/debian/dependency"
+)
+
+// BuildDependsOptions controls which build relations of a source package
+// are checked by Resolver.ResolveBuildDepends.
+type BuildDependsOptions struct {
+	// The architecture the package is being built for. For a native build,
+	// this is the same as the Resolver's Arch (the build architecture),
+	// which is also used if Host is left unset.
+	Host dependency.Arch
+
+	// Only consider the relations needed to build the architecture
+	// dependent binaries (Build-Depends and Build-Depends-Arch), as with
+	// `dpkg-buildpackage -B`.
+	ArchOnly bool
+
+	// Only consider the relations needed to build the architecture
+	// independent binaries (Build-Depends and Build-Depends-Indep), as with
+	// `dpkg-buildpackage -A`.
+	IndepOnly bool
+
+	// The build profiles (such as "nocheck" or "stage1") that are active
+	// for this build. Relations whose restriction formula doesn't apply
+	// with this set of profiles are ignored.
+	Profiles []string
+}
+
+// ResolveBuildDepends checks to see if the build relations of the DSC can
+// be satisfied by the packages known to the Resolver, and returns the set
+// of packages that would need to be installed to build it.
+//
+// The Resolver's Arch is taken to be the build architecture, and the
+// BuildDependsOptions.Host architecture the one being built for, which
+// allows cross builds to be checked as well as native ones. As with
+// dpkg-checkbuilddeps, architecture restrictions are evaluated against the
+// host architecture, unqualified relations must be satisfied by packages of
+// the host architecture (unless the package is Multi-Arch: foreign),
+// relations qualified with :native must be satisfied by packages of the
+// build architecture, and relations qualified with :any may be satisfied
+// by Multi-Arch: allowed packages of any architecture.
+//
+// Build-Conflicts, Build-Conflicts-Arch and Build-Conflicts-Indep are
+// honoured as well. Note that build-essential is not implied; add it to
+// the DSC relations (or check it separately) if needed.
+func (r *Resolver) ResolveBuildDepends(dsc DSC, options BuildDependsOptions) ([]BinaryIndex, error) {
+	host := options.Host
+	if host == (dependency.Arch{}) {
+		host = r.Arch
+	}
+
+	depends := []dependency.Dependency{dsc.BuildDepends}
+	conflicts := []dependency.Dependency{
+		dsc.getOptionalDependencyField("Build-Conflicts"),
+	}
+	if !options.IndepOnly {
+		depends = append(depends, dsc.BuildDependsArch)
+		conflicts = append(conflicts, dsc.getOptionalDependencyField("Build-Conflicts-Arch"))
+	}
+	if !options.ArchOnly {
+		depends = append(depends, dsc.BuildDependsIndep)
+		conflicts = append(conflicts, dsc.getOptionalDependencyField("Build-Conflicts-Indep"))
+	}
+
+	relations := []dependency.Relation{}
+	for _, dep := range depends {
+		relations = append(relations, dep.GetRelationsWithProfiles(host, options.Profiles)...)
+	}
+
+	forbidden := []dependency.Possibility{}
+	for _, dep := range conflicts {
+		forbidden = append(forbidden, dep.GetPossibilitiesWithProfiles(host, options.Profiles)...)
+	}
+
+	return r.resolve(relations, forbidden, host)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,130 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+// Test Build Packages {{{
+const buildPackages = `Package: make
+Version: 4.3-4.1
+Architecture: amd64
+Multi-Arch: foreign
+
+Package: python3
+Version: 3.11.2-1
+Architecture: amd64
+Multi-Arch: allowed
+
+Package: python3
+Version: 3.11.2-1
+Architecture: armhf
+Multi-Arch: allowed
+
+Package: libfoo-dev
+Version: 1.0-1
+Architecture: amd64
+Multi-Arch: same
+
+Package: libfoo-dev
+Version: 1.0-1
+Architecture: armhf
+Multi-Arch: same
+
+Package: libbar-dev
+Version: 1.0-1
+Architecture: amd64
+
+Package: docs-tool
+Version: 1.0-1
+Architecture: all
+Conflicts: libfoo-dev
+`
+
+// }}}
+
+// Test Build DSC {{{
+const buildDsc = `Format: 3.0 (quilt)
+Source: foo
+Binary: foo, foo-doc
+Architecture: any all
+Version: 1.0-1
+Build-Depends: make, python3:native, libfoo-dev, libbar-dev [amd64], test-runner <!nocheck>
+Build-Depends-Indep: docs-tool
+Build-Conflicts-Arch: python3:armhf
+`
+
+// }}}
+
+func TestResolveBuildDepends(t *testing.T) {
+	indices, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(buildPackages)))
+	isok(t, err)
+	dsc, err := control.ParseDsc(bufio.NewReader(strings.NewReader(buildDsc)), "")
+	isok(t, err)
+
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	armhf, err := dependency.ParseArch("armhf")
+	isok(t, err)
+
+	resolver := control.NewResolver(*amd64, indices)
+
+	/* docs-tool conflicts with libfoo-dev, so a full build can't work */
+	_, err = resolver.ResolveBuildDepends(*dsc, control.BuildDependsOptions{})
+	notok(t, err)
+
+	/* test-runner doesn't exist, so only nocheck builds can work */
+	_, err = resolver.ResolveBuildDepends(*dsc, control.BuildDependsOptions{
+		ArchOnly: true,
+	})
+	notok(t, err)
+
+	installed, err := resolver.ResolveBuildDepends(*dsc, control.BuildDependsOptions{
+		ArchOnly: true,
+		Profiles: []string{"nocheck"},
+	})
+	isok(t, err)
+	assert(t, strings.Join(resolvedNames(installed), " ") ==
+		"libbar-dev:amd64 libfoo-dev:amd64 make:amd64 python3:amd64")
+
+	/* Cross building for armhf, libbar-dev is not needed, libfoo-dev must
+	 * be the armhf one, and make and python3 come from the build arch. */
+	installed, err = resolver.ResolveBuildDepends(*dsc, control.BuildDependsOptions{
+		Host:     *armhf,
+		ArchOnly: true,
+		Profiles: []string{"nocheck"},
+	})
+	isok(t, err)
+	assert(t, strings.Join(resolvedNames(installed), " ") ==
+		"libfoo-dev:armhf make:amd64 python3:amd64")
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,294 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// {{{ Installed-Build-Depends entries
+
+// A BuildInfoPackage is an entry in the Installed-Build-Depends field of a
+// .buildinfo file, which records the exact version of a package that was
+// installed during the build, such as "libc6 (= 2.36-9)". The Arch is only
+// set if the entry has an architecture qualifier.
+type BuildInfoPackage struct {
+	Name    string
+	Arch    string
+	Version version.Version
+}
+
+func (p *BuildInfoPackage) UnmarshalControl(data string) error {
+	dep, err := dependency.Parse(data)
+	if err != nil {
+		return err
+	}
+	if len(dep.Relations) != 1 || len(dep.Relations[0].Possibilities) != 1 {
+		return fmt.Errorf("Malformed Installed-Build-Depends entry: '%s'", data)
+	}
+	possi := dep.Relations[0].Possibilities[0]
+	if possi.Version == nil || possi.Version.Operator != "=" {
+		return fmt.Errorf("Installed-Build-Depends entry has no exact version: '%s'", data)
+	}
+
+	p.Name = possi.Name
+	p.Arch = ""
+	if possi.Arch != nil {
+		p.Arch = possi.Arch.String()
+	}
+	p.Version, err = version.Parse(possi.Version.Number)
+	return err
+}
+
+func (p BuildInfoPackage) MarshalControl() (string, error) {
+	return fmt.Sprintf("%s (= %s)", p.Key(), p.Version), nil
+}
+
+// Return the name of the package, along with the architecture qualifier
+// if there is one (such as "libc6:amd64").
+func (p BuildInfoPackage) Key() string {
+	if p.Arch == "" {
+		return p.Name
+	}
+	return p.Name + ":" + p.Arch
+}
+
+// }}}
+
+// The BuildInfo struct is the encapsulation of a Debian .buildinfo file,
+// which records the environment a package was built in, and the checksums
+// of the artifacts that came out of the build, so that the build may be
+// reproduced and the results compared. See deb-buildinfo(5).
+type BuildInfo struct {
+	Paragraph
+
+	Filename string `control:"-"`
+
+	Format             string
+	Source             string
+	Binaries           []string          `control:"Binary" delim:" "`
+	Architectures      []dependency.Arch `control:"Architecture"`
+	Version            version.Version
+	BinaryOnlyChanges  string             `control:"Binary-Only-Changes" multiline:"true"`
+	ChecksumsMd5       []MD5FileHash      `control:"Checksums-Md5" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha1      []SHA1FileHash     `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256    []SHA256FileHash   `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	BuildOrigin        string             `control:"Build-Origin"`
+	BuildArchitecture  dependency.Arch    `control:"Build-Architecture"`
+	BuildDate          string             `control:"Build-Date"`
+	BuildKernelVersion string             `control:"Build-Kernel-Version"`
+	BuildPath          string             `control:"Build-Path"`
+	BuildTaintedBy     []string           `control:"Build-Tainted-By" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	InstalledBuildDeps []BuildInfoPackage `control:"Installed-Build-Depends" delim:",\n" strip:"\n\r\t ," multiline:"true"`
+	Environment        []string           `control:"Environment" delim:"\n" strip:"\n\r\t " multiline:"true"`
+}
+
+// Given a path on the filesystem, Parse the file off the disk and return
+// a pointer to a brand new BuildInfo struct, unless error is set to a value
+// other than nil.
+func ParseBuildInfoFile(path string) (ret *BuildInfo, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseBuildInfo(bufio.NewReader(f), path)
+}
+
+// Given a bufio.Reader, consume the Reader, and return a BuildInfo object
+// for use. The "path" argument is used to set BuildInfo.Filename.
+func ParseBuildInfo(reader *bufio.Reader, path string) (*BuildInfo, error) {
+	ret := BuildInfo{Filename: path}
+	if err := Unmarshal(&ret, reader); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Return the Environment field as a map of variable names to their
+// (unquoted) values.
+func (b *BuildInfo) GetEnvironment() (map[string]string, error) {
+	ret := map[string]string{}
+	for _, entry := range b.Environment {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Malformed Environment entry: '%s'", entry)
+		}
+		value, err := strconv.Unquote(parts[1])
+		if err != nil {
+			/* dpkg quotes every value, but be kind to hand written files */
+			value = parts[1]
+		}
+		ret[parts[0]] = value
+	}
+	return ret, nil
+}
+
+// {{{ Comparing .buildinfo files
+
+// A BuildInfoDifference is a single difference between two BuildInfo
+// files. Field is the name of the field that differs, and Key is the
+// entry within that field (such as the filename of a checksum, or the name
+// of an environment variable), if any. A and B hold the values from each
+// BuildInfo, and are empty if the entry is missing from that BuildInfo.
+type BuildInfoDifference struct {
+	Field string
+	Key   string
+	A     string
+	B     string
+}
+
+func (d BuildInfoDifference) String() string {
+	name := d.Field
+	if d.Key != "" {
+		name = fmt.Sprintf("%s %s", d.Field, d.Key)
+	}
+	return fmt.Sprintf("%s: '%s' != '%s'", name, d.A, d.B)
+}
+
+// Compare this BuildInfo to another, and return every difference between
+// their artifact checksums and their build environments (the build
+// fields, Installed-Build-Depends and Environment), in a stable order.
+//
+// The Build-Date and Build-Kernel-Version fields are expected to differ
+// between builds, and aren't compared. If the Environment of either
+// BuildInfo can't be parsed, an error is returned.
+func (b *BuildInfo) Diff(other *BuildInfo) ([]BuildInfoDifference, error) {
+	ret := []BuildInfoDifference{}
+
+	for _, field := range []struct {
+		name string
+		a, b string
+	}{
+		{"Source", b.Source, other.Source},
+		{"Version", b.Version.String(), other.Version.String()},
+		{"Build-Origin", b.BuildOrigin, other.BuildOrigin},
+		{"Build-Architecture", b.BuildArchitecture.String(), other.BuildArchitecture.String()},
+		{"Build-Path", b.BuildPath, other.BuildPath},
+		{"Build-Tainted-By", strings.Join(b.BuildTaintedBy, " "), strings.Join(other.BuildTaintedBy, " ")},
+	} {
+		if field.a != field.b {
+			ret = append(ret, BuildInfoDifference{Field: field.name, A: field.a, B: field.b})
+		}
+	}
+
+	checksums := func(hashes []FileHash) map[string]string {
+		ret := map[string]string{}
+		for _, hash := range hashes {
+			ret[hash.Filename] = hash.Hash
+		}
+		return ret
+	}
+	ret = append(ret, diffMaps("Checksums-Sha256",
+		checksums(b.sha256Hashes()), checksums(other.sha256Hashes()))...)
+	ret = append(ret, diffMaps("Checksums-Sha1",
+		checksums(b.sha1Hashes()), checksums(other.sha1Hashes()))...)
+	ret = append(ret, diffMaps("Checksums-Md5",
+		checksums(b.md5Hashes()), checksums(other.md5Hashes()))...)
+
+	packages := func(entries []BuildInfoPackage) map[string]string {
+		ret := map[string]string{}
+		for _, entry := range entries {
+			ret[entry.Key()] = entry.Version.String()
+		}
+		return ret
+	}
+	ret = append(ret, diffMaps("Installed-Build-Depends",
+		packages(b.InstalledBuildDeps), packages(other.InstalledBuildDeps))...)
+
+	environment, err := b.GetEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	otherEnvironment, err := other.GetEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, diffMaps("Environment", environment, otherEnvironment)...)
+
+	return ret, nil
+}
+
+// Return a BuildInfoDifference for each key whose value differs between
+// the two maps, sorted by key.
+func diffMaps(field string, a, b map[string]string) []BuildInfoDifference {
+	keys := []string{}
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	ret := []BuildInfoDifference{}
+	for _, key := range keys {
+		if a[key] != b[key] {
+			ret = append(ret, BuildInfoDifference{Field: field, Key: key, A: a[key], B: b[key]})
+		}
+	}
+	return ret
+}
+
+func (b *BuildInfo) md5Hashes() []FileHash {
+	ret := []FileHash{}
+	for _, hash := range b.ChecksumsMd5 {
+		ret = append(ret, hash.FileHash)
+	}
+	return ret
+}
+
+func (b *BuildInfo) sha1Hashes() []FileHash {
+	ret := []FileHash{}
+	for _, hash := range b.ChecksumsSha1 {
+		ret = append(ret, hash.FileHash)
+	}
+	return ret
+}
+
+func (b *BuildInfo) sha256Hashes() []FileHash {
+	ret := []FileHash{}
+	for _, hash := range b.ChecksumsSha256 {
+		ret = append(ret, hash.FileHash)
+	}
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,139 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// Test BuildInfo {{{
+const testBuildInfo = `Format: 1.0
+Source: hello
+Binary: hello
+Architecture: amd64
+Version: 2.10-3
+Binary-Only-Changes:
+ hello (2.10-3+b1) sid; urgency=low, binary-only=yes
+ .
+   * Binary-only non-maintainer upload for amd64; no source changes.
+ .
+  -- amd64 Build Daemon (x86-ubc-02) <buildd@x86-ubc-02.debian.org>  Sat, 05 Aug 2023 09:30:21 +0000
+Checksums-Md5:
+ 0bd6b7c8d2b4b9d5fa9f4dd3fd6e9b5c 56132 hello_2.10-3_amd64.deb
+Checksums-Sha1:
+ e0f0d3ed5b2dcad2d3d6d5cdc77d5b5c1d5b5a5d 56132 hello_2.10-3_amd64.deb
+Checksums-Sha256:
+ d4e2ce27bd1faf5ab6fc1c1efbdff4b3e6b0e5e25a4c3c82d7c80f1fc2cd3dc6 56132 hello_2.10-3_amd64.deb
+Build-Origin: Debian
+Build-Architecture: amd64
+Build-Date: Sat, 05 Aug 2023 09:30:21 +0000
+Build-Kernel-Version: 6.1.0-10-amd64 #1 SMP PREEMPT_DYNAMIC Debian 6.1.38-2 (2023-07-27)
+Build-Path: /build/reproducible-path/hello-2.10
+Build-Tainted-By:
+ merged-usr-via-aliased-dirs
+ usr-local-has-programs
+Installed-Build-Depends:
+ autoconf (= 2.71-3),
+ debhelper (= 13.11.4),
+ libc6 (= 2.36-9+deb12u1),
+ libc6:i386 (= 2.36-9+deb12u1)
+Environment:
+ DEB_BUILD_OPTIONS="parallel=4"
+ LANG="C.UTF-8"
+ SOURCE_DATE_EPOCH="1691227821"
+`
+
+// }}}
+
+func TestBuildInfoParse(t *testing.T) {
+	buildInfo, err := control.ParseBuildInfo(bufio.NewReader(strings.NewReader(testBuildInfo)), "")
+	isok(t, err)
+
+	assert(t, buildInfo.Source == "hello")
+	assert(t, buildInfo.Version.String() == "2.10-3")
+	assert(t, buildInfo.BuildArchitecture.CPU == "amd64")
+	assert(t, buildInfo.BuildPath == "/build/reproducible-path/hello-2.10")
+	assert(t, strings.HasPrefix(buildInfo.BinaryOnlyChanges, "hello (2.10-3+b1) sid;"))
+	assert(t, len(buildInfo.BuildTaintedBy) == 2)
+	assert(t, buildInfo.BuildTaintedBy[1] == "usr-local-has-programs")
+
+	assert(t, len(buildInfo.ChecksumsSha256) == 1)
+	assert(t, buildInfo.ChecksumsSha256[0].Filename == "hello_2.10-3_amd64.deb")
+	assert(t, buildInfo.ChecksumsSha256[0].Size == 56132)
+
+	assert(t, len(buildInfo.InstalledBuildDeps) == 4)
+	assert(t, buildInfo.InstalledBuildDeps[1].Name == "debhelper")
+	assert(t, buildInfo.InstalledBuildDeps[1].Version.String() == "13.11.4")
+	assert(t, buildInfo.InstalledBuildDeps[3].Key() == "libc6:i386")
+
+	environment, err := buildInfo.GetEnvironment()
+	isok(t, err)
+	assert(t, len(environment) == 3)
+	assert(t, environment["DEB_BUILD_OPTIONS"] == "parallel=4")
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, buildInfo))
+	assert(t, writer.String() == testBuildInfo)
+}
+
+func TestBuildInfoDiff(t *testing.T) {
+	a, err := control.ParseBuildInfo(bufio.NewReader(strings.NewReader(testBuildInfo)), "")
+	isok(t, err)
+	b, err := control.ParseBuildInfo(bufio.NewReader(strings.NewReader(testBuildInfo)), "")
+	isok(t, err)
+	diff, err := a.Diff(b)
+	isok(t, err)
+	assert(t, len(diff) == 0)
+
+	b.BuildDate = "Sun, 06 Aug 2023 09:30:21 +0000"
+	b.BuildPath = "/build/other"
+	b.ChecksumsSha256[0].Hash = "0000"
+	b.InstalledBuildDeps = b.InstalledBuildDeps[:3]
+	b.Environment = append(b.Environment, `TZ="UTC"`)
+
+	diff, err = a.Diff(b)
+	isok(t, err)
+	assert(t, len(diff) == 4)
+	assert(t, diff[0].Field == "Build-Path")
+	assert(t, diff[1].Field == "Checksums-Sha256")
+	assert(t, diff[1].Key == "hello_2.10-3_amd64.deb")
+	assert(t, diff[1].B == "0000")
+	assert(t, diff[2].Key == "libc6:i386" && diff[2].B == "")
+	assert(t, diff[3].String() == "Environment TZ: '' != 'UTC'")
+
+	/* A malformed Environment is an error, not a list of differences */
+	b.Environment = append(b.Environment, "GARBAGE")
+	_, err = a.Diff(b)
+	notok(t, err)
+	_, err = b.Diff(a)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
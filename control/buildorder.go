@@ -0,0 +1,485 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+
+	"pault.ag/go/topsort"
+)
+
+// Build Depends Edges {{{
+
+// A BuildDependsEdge is a Build-Depends relation of one source package on
+// a binary package built by another, which means that `From` has to be
+// built before `To`.
+type BuildDependsEdge struct {
+	From   string
+	To     string
+	Binary string
+}
+
+func (edge BuildDependsEdge) String() string {
+	if edge.Binary == "" {
+		return fmt.Sprintf("%s -> %s", edge.From, edge.To)
+	}
+	return fmt.Sprintf("%s -> %s (%s)", edge.From, edge.To, edge.Binary)
+}
+
+// Map each binary package built on `arch` to the source that builds it.
+func binarySources(dscs []DSC, arch dependency.Arch) map[string]string {
+	sourceMapping := map[string]string{}
+	for _, dsc := range dscs {
+		for _, binary := range dsc.GetBinaries(arch) {
+			sourceMapping[binary] = dsc.Source
+		}
+	}
+	return sourceMapping
+}
+
+// Return the Build-Depends, Build-Depends-Arch and Build-Depends-Indep
+// relations of `dsc` on `arch`. If `profiles` isn't nil, relations which
+// don't apply when building with those build profiles are dropped.
+func buildDependsPossibilities(dsc DSC, arch dependency.Arch, profiles []string) []dependency.Possibility {
+	ret := []dependency.Possibility{}
+	for _, field := range []dependency.Dependency{
+		dsc.BuildDepends, dsc.BuildDependsArch, dsc.BuildDependsIndep,
+	} {
+		if profiles == nil {
+			ret = append(ret, field.GetPossibilities(arch)...)
+		} else {
+			ret = append(ret, field.GetPossibilitiesWithProfiles(arch, profiles)...)
+		}
+	}
+	return ret
+}
+
+// Return the edges from each source that builds one of the Build-Depends
+// of `dsc`, to `dsc`.
+func buildDependsEdges(
+	dsc DSC,
+	arch dependency.Arch,
+	profiles []string,
+	sourceMapping map[string]string,
+) []BuildDependsEdge {
+	ret := []BuildDependsEdge{}
+	for _, relation := range buildDependsPossibilities(dsc, arch, profiles) {
+		if source, ok := sourceMapping[relation.Name]; ok {
+			ret = append(ret, BuildDependsEdge{
+				From:   source,
+				To:     dsc.Source,
+				Binary: relation.Name,
+			})
+		}
+	}
+	return ret
+}
+
+// }}}
+
+// Build Cycles {{{
+
+// A BuildCycle is a strongly connected component of the build order:
+// a set of sources which all (indirectly) Build-Depend on each other, along
+// with the Build-Depends edges between them.
+type BuildCycle struct {
+	Sources []string
+	Edges   []BuildDependsEdge
+}
+
+// A BuildCycleError is returned when sources can't be ordered for build,
+// since their Build-Depends form one or more cycles.
+type BuildCycleError struct {
+	Cycles []BuildCycle
+}
+
+func (e *BuildCycleError) Error() string {
+	cycles := []string{}
+	for _, cycle := range e.Cycles {
+		edges := []string{}
+		for _, edge := range cycle.Edges {
+			edges = append(edges, edge.String())
+		}
+		cycles = append(cycles, fmt.Sprintf(
+			"{%s: %s}", strings.Join(cycle.Sources, ", "), strings.Join(edges, ", "),
+		))
+	}
+	return fmt.Sprintf("Build-Depends cycles: %s", strings.Join(cycles, " "))
+}
+
+// Find every strongly connected component of the graph formed by `edges`
+// which contains a cycle (including a source depending on itself), using
+// Tarjan's algorithm.
+func findBuildCycles(edges []BuildDependsEdge) []BuildCycle {
+	outbound := map[string][]string{}
+	nodes := []string{}
+	seen := map[string]bool{}
+	for _, edge := range edges {
+		for _, node := range []string{edge.From, edge.To} {
+			if !seen[node] {
+				seen[node] = true
+				nodes = append(nodes, node)
+			}
+		}
+		outbound[edge.From] = append(outbound[edge.From], edge.To)
+	}
+
+	index := map[string]int{}
+	lowlink := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	component := map[string]int{}
+	components := [][]string{}
+
+	var connect func(node string)
+	connect = func(node string) {
+		index[node] = len(index)
+		lowlink[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, next := range outbound[node] {
+			if _, visited := index[next]; !visited {
+				connect(next)
+				if lowlink[next] < lowlink[node] {
+					lowlink[node] = lowlink[next]
+				}
+			} else if onStack[next] && index[next] < lowlink[node] {
+				lowlink[node] = index[next]
+			}
+		}
+
+		if lowlink[node] == index[node] {
+			members := []string{}
+			for {
+				member := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[member] = false
+				component[member] = len(components)
+				members = append(members, member)
+				if member == node {
+					break
+				}
+			}
+			components = append(components, members)
+		}
+	}
+	for _, node := range nodes {
+		if _, visited := index[node]; !visited {
+			connect(node)
+		}
+	}
+
+	cycleEdges := make([][]BuildDependsEdge, len(components))
+	for _, edge := range edges {
+		if component[edge.From] == component[edge.To] {
+			id := component[edge.From]
+			cycleEdges[id] = append(cycleEdges[id], edge)
+		}
+	}
+
+	ret := []BuildCycle{}
+	for id, members := range components {
+		if len(cycleEdges[id]) == 0 {
+			continue
+		}
+		sort.Strings(members)
+		ret = append(ret, BuildCycle{Sources: members, Edges: cycleEdges[id]})
+	}
+	return ret
+}
+
+// }}}
+
+// Staged Builds {{{
+
+// A BuildStep is a single build of a source package, with the given set
+// of build profiles active.
+type BuildStep struct {
+	DSC      DSC
+	Profiles []string
+}
+
+// Check to see if `binary` is built by `dsc` when building with the given
+// build profiles.
+func buildsWithProfiles(dsc DSC, binary string, profiles []string) bool {
+	for _, entry := range dsc.PackageList {
+		if entry.Package == binary {
+			return entry.BuildsWithProfiles(profiles)
+		}
+	}
+	return true
+}
+
+// Like OrderDSCForBuild, but rather than failing when the Build-Depends
+// of some sources form a cycle, each source in a cycle is first built
+// with the given build `profiles` active (such as "stage1" or "nocheck"),
+// which will drop some of its Build-Depends, and then built again with
+// no profiles once everything in its cycle has been built once.
+//
+// Sources which aren't part of a cycle are only built once, with no
+// profiles. If the cycles can't be broken with `profiles`, a
+// *BuildCycleError is returned, listing the cycles that remain.
+func OrderDSCForStagedBuild(dscs []DSC, arch dependency.Arch, profiles []string) ([]BuildStep, error) {
+	sourceMapping := binarySources(dscs, arch)
+	bySource := map[string]DSC{}
+	edges := []BuildDependsEdge{}
+	for _, dsc := range dscs {
+		bySource[dsc.Source] = dsc
+		edges = append(edges, buildDependsEdges(dsc, arch, nil, sourceMapping)...)
+	}
+
+	cycleOf := map[string]int{}
+	for id, cycle := range findBuildCycles(edges) {
+		for _, source := range cycle.Sources {
+			cycleOf[source] = id
+		}
+	}
+	sameCycle := func(a, b string) bool {
+		aCycle, aOk := cycleOf[a]
+		bCycle, bOk := cycleOf[b]
+		return aOk && bOk && aCycle == bCycle
+	}
+	stageName := func(source string) string {
+		return source + " <" + strings.Join(profiles, " ") + ">"
+	}
+
+	network := topsort.NewNetwork()
+	for _, dsc := range dscs {
+		if _, ok := cycleOf[dsc.Source]; ok {
+			network.AddNode(stageName(dsc.Source), BuildStep{DSC: dsc, Profiles: profiles})
+		}
+		network.AddNode(dsc.Source, BuildStep{DSC: dsc})
+	}
+
+	/* Edges between the nodes in `network`, used to report any cycles
+	 * which are left. */
+	stagedEdges := []BuildDependsEdge{}
+	addEdge := func(edge BuildDependsEdge) error {
+		stagedEdges = append(stagedEdges, edge)
+		return network.AddEdge(edge.From, edge.To)
+	}
+
+	for _, dsc := range dscs {
+		if _, ok := cycleOf[dsc.Source]; ok {
+			/* The staged build of a source only needs its cycle to
+			 * have been built with profiles too. */
+			for _, edge := range buildDependsEdges(dsc, arch, profiles, sourceMapping) {
+				edge.To = stageName(dsc.Source)
+				if sameCycle(edge.From, dsc.Source) &&
+					buildsWithProfiles(bySource[edge.From], edge.Binary, profiles) {
+					edge.From = stageName(edge.From)
+				}
+				if err := addEdge(edge); err != nil {
+					return nil, err
+				}
+			}
+			if err := addEdge(BuildDependsEdge{
+				From: stageName(dsc.Source),
+				To:   dsc.Source,
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, edge := range buildDependsEdges(dsc, arch, nil, sourceMapping) {
+			if sameCycle(edge.From, edge.To) &&
+				buildsWithProfiles(bySource[edge.From], edge.Binary, profiles) {
+				edge.From = stageName(edge.From)
+			}
+			if err := addEdge(edge); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	nodes, err := network.Sort()
+	if err != nil {
+		if cycles := findBuildCycles(stagedEdges); len(cycles) != 0 {
+			return nil, &BuildCycleError{Cycles: cycles}
+		}
+		return nil, err
+	}
+
+	ret := []BuildStep{}
+	for _, node := range nodes {
+		ret = append(ret, node.Value.(BuildStep))
+	}
+	return ret, nil
+}
+
+// }}}
+
+// Build Waves {{{
+
+// A BuildWave is a set of builds which can all run at the same time, since
+// all of their Build-Depends are built in earlier waves.
+type BuildWave struct {
+	// Sources to build the architecture dependent packages of.
+	Any []DSC
+
+	// Sources to build the arch:all packages of, which only needs to be
+	// done on one architecture.
+	All []DSC
+}
+
+// A single build in a BuildWave: either the architecture dependent
+// (binary-arch) or arch:all (binary-indep) half of a source package.
+type waveJob struct {
+	dsc     DSC
+	archAll bool
+}
+
+func (job waveJob) String() string {
+	if job.archAll {
+		return job.dsc.Source + " [all]"
+	}
+	return job.dsc.Source + " [any]"
+}
+
+// Check to see if this .dsc builds any architecture dependent packages.
+// A .dsc without an Architecture field is assumed to.
+func hasArchAny(dsc DSC) bool {
+	for _, arch := range dsc.Architectures {
+		if arch.CPU != "all" {
+			return true
+		}
+	}
+	return len(dsc.Architectures) == 0
+}
+
+// Return which of the jobs of a source build `binary`. Without a
+// Package-List entry for it, it could come from any of them.
+func binaryJobs(jobs []waveJob, binary string) []waveJob {
+	for _, entry := range jobs[0].dsc.PackageList {
+		if entry.Package != binary {
+			continue
+		}
+		archAll := len(entry.Architectures) == 1 && entry.Architectures[0].CPU == "all"
+		for _, job := range jobs {
+			if job.archAll == archAll {
+				return []waveJob{job}
+			}
+		}
+	}
+	return jobs
+}
+
+// Given a bunch of DSC objects, split them into waves of builds, such that
+// the Build-Depends of every build in a wave are built by earlier waves,
+// so every build in a wave can run in parallel.
+//
+// The architecture dependent packages and the arch:all packages (see
+// DSC.HasArchAll) of a source are planned as separate builds, since
+// arch:all packages are only built on one architecture, and need the
+// Build-Depends-Indep rather than the Build-Depends-Arch.
+//
+// If the Build-Depends form a cycle, a *BuildCycleError is returned.
+func PlanDSCBuildWaves(dscs []DSC, arch dependency.Arch) ([]BuildWave, error) {
+	sourceMapping := binarySources(dscs, arch)
+
+	jobs := []waveJob{}
+	jobsBySource := map[string][]waveJob{}
+	for _, dsc := range dscs {
+		if _, ok := jobsBySource[dsc.Source]; ok {
+			continue
+		}
+		if hasArchAny(dsc) {
+			jobsBySource[dsc.Source] = append(jobsBySource[dsc.Source], waveJob{dsc: dsc})
+		}
+		if dsc.HasArchAll() {
+			jobsBySource[dsc.Source] = append(jobsBySource[dsc.Source], waveJob{dsc: dsc, archAll: true})
+		}
+		jobs = append(jobs, jobsBySource[dsc.Source]...)
+	}
+
+	edges := []BuildDependsEdge{}
+	inbound := map[string]map[string]bool{}
+	for _, job := range jobs {
+		inbound[job.String()] = map[string]bool{}
+
+		dependencies := job.dsc.BuildDependsArch
+		if job.archAll {
+			dependencies = job.dsc.BuildDependsIndep
+		}
+		possibilities := job.dsc.BuildDepends.GetPossibilities(arch)
+		possibilities = append(possibilities, dependencies.GetPossibilities(arch)...)
+
+		for _, possi := range possibilities {
+			source, ok := sourceMapping[possi.Name]
+			if !ok {
+				continue
+			}
+			for _, from := range binaryJobs(jobsBySource[source], possi.Name) {
+				edges = append(edges, BuildDependsEdge{
+					From:   from.String(),
+					To:     job.String(),
+					Binary: possi.Name,
+				})
+				inbound[job.String()][from.String()] = true
+			}
+		}
+	}
+
+	ret := []BuildWave{}
+	built := map[string]bool{}
+	for len(built) < len(jobs) {
+		wave := BuildWave{Any: []DSC{}, All: []DSC{}}
+		ready := []waveJob{}
+		for _, job := range jobs {
+			if built[job.String()] {
+				continue
+			}
+			satisfied := true
+			for from := range inbound[job.String()] {
+				if !built[from] {
+					satisfied = false
+					break
+				}
+			}
+			if satisfied {
+				ready = append(ready, job)
+			}
+		}
+
+		if len(ready) == 0 {
+			return nil, &BuildCycleError{Cycles: findBuildCycles(edges)}
+		}
+		for _, job := range ready {
+			built[job.String()] = true
+			if job.archAll {
+				wave.All = append(wave.All, job.dsc)
+			} else {
+				wave.Any = append(wave.Any, job.dsc)
+			}
+		}
+		ret = append(ret, wave)
+	}
+	return ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
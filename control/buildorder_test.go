@@ -0,0 +1,182 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+func newTestDSC(t *testing.T, source, binaries, buildDepends string) control.DSC {
+	dsc, err := control.ParseDsc(bufio.NewReader(strings.NewReader(
+		"Source: "+source+"\nBinary: "+binaries+"\nVersion: 1.0-1\n"+
+			"Build-Depends: "+buildDepends+"\n",
+	)), "")
+	isok(t, err)
+	return *dsc
+}
+
+func TestOrderDSCForBuildCycle(t *testing.T) {
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	dscs := []control.DSC{
+		newTestDSC(t, "foo", "libfoo-dev", "libbar-dev, debhelper"),
+		newTestDSC(t, "bar", "libbar-dev", "libfoo-dev"),
+		newTestDSC(t, "baz", "baz", "libfoo-dev"),
+		newTestDSC(t, "quux", "quux", "quux"),
+	}
+	_, err = control.OrderDSCForBuild(dscs, *amd64)
+	notok(t, err)
+
+	cycleErr, ok := err.(*control.BuildCycleError)
+	assert(t, ok)
+	assert(t, len(cycleErr.Cycles) == 2)
+
+	cycle := cycleErr.Cycles[0]
+	assert(t, len(cycle.Sources) == 2)
+	assert(t, cycle.Sources[0] == "bar" && cycle.Sources[1] == "foo")
+	assert(t, len(cycle.Edges) == 2)
+	assert(t, cycle.Edges[0].String() == "bar -> foo (libbar-dev)")
+	assert(t, cycle.Edges[1].String() == "foo -> bar (libfoo-dev)")
+
+	/* A source which Build-Depends on itself is a cycle too */
+	cycle = cycleErr.Cycles[1]
+	assert(t, len(cycle.Sources) == 1 && cycle.Sources[0] == "quux")
+	assert(t, len(cycle.Edges) == 1)
+}
+
+func TestOrderDSCForStagedBuild(t *testing.T) {
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	dscs := []control.DSC{
+		newTestDSC(t, "baz", "baz", "libfoo-dev"),
+		newTestDSC(t, "foo", "libfoo-dev", "libbar-dev <!stage1>"),
+		newTestDSC(t, "bar", "libbar-dev", "libfoo-dev, check <!nocheck>"),
+		newTestDSC(t, "check", "check", ""),
+	}
+	steps, err := control.OrderDSCForStagedBuild(dscs, *amd64, []string{"stage1"})
+	isok(t, err)
+	assert(t, len(steps) == 6)
+
+	position := map[string]int{}
+	for i, step := range steps {
+		name := step.DSC.Source
+		if len(step.Profiles) != 0 {
+			assert(t, len(step.Profiles) == 1 && step.Profiles[0] == "stage1")
+			name = name + " <stage1>"
+		}
+		position[name] = i
+	}
+	assert(t, len(position) == 6)
+	assert(t, position["foo <stage1>"] < position["bar <stage1>"])
+	assert(t, position["check"] < position["bar <stage1>"])
+	assert(t, position["foo <stage1>"] < position["bar"])
+	assert(t, position["bar <stage1>"] < position["foo"])
+	assert(t, position["foo"] < position["baz"])
+
+	/* Sources which aren't in a cycle are only built once */
+	steps, err = control.OrderDSCForStagedBuild(dscs[3:], *amd64, []string{"stage1"})
+	isok(t, err)
+	assert(t, len(steps) == 1 && len(steps[0].Profiles) == 0)
+
+	/* nocheck doesn't break the cycle */
+	_, err = control.OrderDSCForStagedBuild(dscs, *amd64, []string{"nocheck"})
+	notok(t, err)
+	cycleErr, ok := err.(*control.BuildCycleError)
+	assert(t, ok)
+	assert(t, len(cycleErr.Cycles) == 1)
+	assert(t, len(cycleErr.Cycles[0].Sources) == 2)
+	assert(t, cycleErr.Cycles[0].Sources[0] == "bar <nocheck>")
+}
+
+func TestPlanDSCBuildWaves(t *testing.T) {
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	libfoo, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: libfoo
+Binary: libfoo-dev, libfoo-doc
+Architecture: any all
+Version: 1.0-1
+Build-Depends: debhelper
+Build-Depends-Indep: doxygen
+Package-List:
+ libfoo-dev deb libdevel optional arch=any
+ libfoo-doc deb doc optional arch=all
+`)), "")
+	isok(t, err)
+	docs, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: docs
+Binary: docs
+Architecture: all
+Version: 1.0-1
+Build-Depends-Indep: libfoo-doc
+`)), "")
+	isok(t, err)
+
+	debhelper := newTestDSC(t, "debhelper", "debhelper", "")
+	debhelper.Architectures = libfoo.Architectures[1:]
+	dscs := []control.DSC{
+		*docs,
+		newTestDSC(t, "app", "app", "libfoo-dev"),
+		*libfoo,
+		newTestDSC(t, "doxygen", "doxygen", "debhelper"),
+		debhelper,
+	}
+
+	waves, err := control.PlanDSCBuildWaves(dscs, *amd64)
+	isok(t, err)
+	assert(t, len(waves) == 4)
+
+	assert(t, len(waves[0].Any) == 0)
+	assert(t, len(waves[0].All) == 1 && waves[0].All[0].Source == "debhelper")
+
+	assert(t, len(waves[1].Any) == 2 && len(waves[1].All) == 0)
+	assert(t, waves[1].Any[0].Source == "libfoo")
+	assert(t, waves[1].Any[1].Source == "doxygen")
+
+	/* libfoo-doc needs doxygen, but app only needs libfoo-dev */
+	assert(t, len(waves[2].Any) == 1 && waves[2].Any[0].Source == "app")
+	assert(t, len(waves[2].All) == 1 && waves[2].All[0].Source == "libfoo")
+
+	assert(t, len(waves[3].Any) == 0)
+	assert(t, len(waves[3].All) == 1 && waves[3].All[0].Source == "docs")
+
+	/* Cycles are reported in terms of each build */
+	_, err = control.PlanDSCBuildWaves([]control.DSC{
+		newTestDSC(t, "foo", "libfoo-dev", "libbar-dev"),
+		newTestDSC(t, "bar", "libbar-dev", "libfoo-dev"),
+	}, *amd64)
+	cycleErr, ok := err.(*control.BuildCycleError)
+	assert(t, ok)
+	assert(t, len(cycleErr.Cycles) == 1)
+	assert(t, cycleErr.Cycles[0].Sources[0] == "bar [any]")
+}
+
+// vim: foldmethod=marker
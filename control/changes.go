@@ -63,6 +63,13 @@ func (c *FileListChangesFileHash) UnmarshalControl(data string) error {
 	return nil
 }
 
+func (c FileListChangesFileHash) MarshalControl() (string, error) {
+	return fmt.Sprintf(
+		"%s %d %s %s %s",
+		c.Hash, c.Size, c.Component, c.Priority, c.Filename,
+	), nil
+}
+
 // }}}
 
 // The Changes struct is the default encapsulation of the Debian .changes
@@ -77,9 +84,10 @@ func (c *FileListChangesFileHash) UnmarshalControl(data string) error {
 type Changes struct {
 	Paragraph
 
-	Filename string
+	Filename string `control:"-"`
 
 	Format          string
+	Date            string
 	Source          string
 	Binaries        []string          `control:"Binary" delim:" "`
 	Architectures   []dependency.Arch `control:"Architecture"`
@@ -90,10 +98,10 @@ type Changes struct {
 	Maintainer      string
 	ChangedBy       string `control:"Changed-By"`
 	Closes          []string
-	Changes         string
-	ChecksumsSha1   []SHA1FileHash            `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t "`
-	ChecksumsSha256 []SHA256FileHash          `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t "`
-	Files           []FileListChangesFileHash `control:"Files" delim:"\n" strip:"\n\r\t "`
+	Changes         string                    `multiline:"true"`
+	ChecksumsSha1   []SHA1FileHash            `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256 []SHA256FileHash          `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	Files           []FileListChangesFileHash `control:"Files" delim:"\n" strip:"\n\r\t " multiline:"true"`
 }
 
 // Given a path on the filesystem, Parse the file off the disk and return
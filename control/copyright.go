@@ -0,0 +1,287 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// {{{ License field
+
+// A CopyrightLicense is the value of a License field in a debian/copyright
+// file: the first line names the license (such as "GPL-2+", or
+// "GPL-2+ or Artistic"), and any lines after it are the license text,
+// or notes about the license.
+type CopyrightLicense struct {
+	Name string
+	Text string
+}
+
+func (l *CopyrightLicense) UnmarshalControl(data string) error {
+	name, text, _ := strings.Cut(data, "\n")
+	l.Name = strings.TrimSpace(name)
+	l.Text = strings.TrimRight(text, "\n")
+	return nil
+}
+
+func (l CopyrightLicense) MarshalControl() (string, error) {
+	if l.Text == "" {
+		return l.Name, nil
+	}
+	return l.Name + "\n" + l.Text, nil
+}
+
+// }}}
+
+// The CopyrightHeader is the first paragraph of a machine-readable
+// debian/copyright file, as defined by DEP-5, which describes the upstream
+// source as a whole.
+type CopyrightHeader struct {
+	Paragraph
+
+	Format          string `required:"true"`
+	UpstreamName    string `control:"Upstream-Name"`
+	UpstreamContact string `control:"Upstream-Contact"`
+	Source          string
+	Disclaimer      string
+	Comment         string
+	License         CopyrightLicense
+	Copyright       string
+	FilesExcluded   []string `control:"Files-Excluded" delim:" "`
+}
+
+// A CopyrightFiles paragraph gives the Copyright and License of the files
+// in the source tree which match any of its Files patterns.
+type CopyrightFiles struct {
+	Paragraph
+
+	Files     []string         `required:"true" delim:" "`
+	Copyright string           `required:"true"`
+	License   CopyrightLicense `required:"true"`
+	Comment   string
+
+	/* The Files patterns, compiled by Matches, and the patterns they were
+	 * compiled from, in case Files has been changed since */
+	expressions     []*regexp.Regexp `control:"-"`
+	expressionFiles []string         `control:"-"`
+}
+
+// A stand-alone License paragraph gives the full text of a license that
+// is named in a Files paragraph (or the header).
+type CopyrightLicenseParagraph struct {
+	Paragraph
+
+	License CopyrightLicense `required:"true"`
+	Comment string
+}
+
+// A Copyright is the encapsulation of a machine-readable debian/copyright
+// file (see https://dep-team.pages.debian.net/deps/dep5/), made up of a
+// header paragraph, followed by Files paragraphs, and stand-alone License
+// paragraphs, in any order.
+type Copyright struct {
+	Filename string
+
+	Header   CopyrightHeader
+	Files    []CopyrightFiles
+	Licenses []CopyrightLicenseParagraph
+}
+
+// Given a path on the filesystem, Parse the file off the disk and return
+// a pointer to a brand new Copyright struct, unless error is set to a value
+// other than nil.
+func ParseCopyrightFile(path string) (ret *Copyright, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseCopyright(bufio.NewReader(f), path)
+}
+
+// Given a bufio.Reader, consume the Reader, and return a Copyright object
+// for use.
+func ParseCopyright(reader *bufio.Reader, path string) (*Copyright, error) {
+	ret := Copyright{
+		Filename: path,
+		Files:    []CopyrightFiles{},
+		Licenses: []CopyrightLicenseParagraph{},
+	}
+
+	paragraphs, err := NewParagraphReader(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := paragraphs.Next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("Empty copyright file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := UnpackFromParagraph(normalizePatterns(*header, "Files-Excluded"), &ret.Header); err != nil {
+		return nil, err
+	}
+
+	for {
+		paragraph, err := paragraphs.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := paragraph.Values["Files"]; ok {
+			files := CopyrightFiles{}
+			if err := UnpackFromParagraph(normalizePatterns(*paragraph, "Files"), &files); err != nil {
+				return nil, err
+			}
+			ret.Files = append(ret.Files, files)
+			continue
+		}
+
+		license := CopyrightLicenseParagraph{}
+		if err := UnpackFromParagraph(*paragraph, &license); err != nil {
+			return nil, err
+		}
+		ret.Licenses = append(ret.Licenses, license)
+	}
+
+	return &ret, nil
+}
+
+// The list of patterns in a Files field may be spread over several lines,
+// so put them on one line, separated by single spaces.
+func normalizePatterns(paragraph Paragraph, key string) Paragraph {
+	if value, ok := paragraph.Values[key]; ok {
+		paragraph.Values[key] = strings.Join(strings.Fields(value), " ")
+	}
+	return paragraph
+}
+
+// Convert a Files pattern into a regular expression. A "*" matches any
+// number of characters (including "/"), "?" matches a single character,
+// and a backslash escapes the character following it.
+func copyrightPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	expression := strings.Builder{}
+	expression.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		case '\\':
+			i++
+			if i == len(pattern) {
+				return nil, fmt.Errorf("Trailing backslash in Files pattern '%s'", pattern)
+			}
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expression.WriteString("$")
+	return regexp.Compile(expression.String())
+}
+
+// Check to see if the path `name`, relative to the root of the source
+// tree, matches any of the Files patterns of this paragraph.
+func (f *CopyrightFiles) Matches(name string) (bool, error) {
+	if !slices.Equal(f.expressionFiles, f.Files) {
+		expressions := []*regexp.Regexp{}
+		for _, pattern := range f.Files {
+			expression, err := copyrightPatternRegexp(strings.TrimPrefix(pattern, "./"))
+			if err != nil {
+				return false, err
+			}
+			expressions = append(expressions, expression)
+		}
+		f.expressions = expressions
+		f.expressionFiles = slices.Clone(f.Files)
+	}
+
+	name = strings.TrimPrefix(filepath.ToSlash(name), "./")
+	for _, expression := range f.expressions {
+		if expression.MatchString(name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Return the Files paragraph that applies to the path `name`, relative to
+// the root of the source tree. When several paragraphs match, the last
+// one in the file wins. If none of them match, nil is returned.
+func (c *Copyright) FilesFor(name string) (*CopyrightFiles, error) {
+	for i := len(c.Files) - 1; i >= 0; i-- {
+		matches, err := c.Files[i].Matches(name)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			return &c.Files[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Return the License that applies to the path `name`, relative to the root
+// of the source tree. If the Files paragraph only names the license, the
+// text is filled in from the stand-alone License paragraph of that name,
+// if there is one.
+func (c *Copyright) LicenseFor(name string) (*CopyrightLicense, error) {
+	files, err := c.FilesFor(name)
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		return nil, fmt.Errorf("No Files paragraph matches '%s'", name)
+	}
+
+	license := files.License
+	if license.Text == "" {
+		for _, paragraph := range c.Licenses {
+			if paragraph.License.Name == license.Name {
+				license.Text = paragraph.License.Text
+				break
+			}
+		}
+	}
+	return &license, nil
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,163 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// Test Copyright {{{
+const testCopyright = `Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: hello
+Upstream-Contact: Jane Doe <jane@example.com>
+Source: https://example.com/hello
+Files-Excluded: vendor/*
+ *.min.js
+
+Files: *
+Copyright: 2010-2023 Jane Doe <jane@example.com>
+License: GPL-3+
+
+Files: lib/*
+ compat/strl?.c
+Copyright: 2015 John Doe
+           2016 Example Corp
+License: MIT
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software.
+ .
+ The above copyright notice shall be included.
+
+Files: lib/vendored/*
+ lib/with\*star.c
+Copyright: 2020 Someone Else
+License: BSD-3-Clause or GPL-3+
+
+Files: debian/*
+Copyright: 2023 Paul Tagliamonte <paultag@debian.org>
+License: GPL-3+
+
+License: GPL-3+
+ This program is free software; you can redistribute it and/or modify
+ it under the terms of the GNU General Public License.
+ .
+ On Debian systems, the complete text of the GNU General Public License
+ version 3 can be found in "/usr/share/common-licenses/GPL-3".
+`
+
+// }}}
+
+func TestCopyrightParse(t *testing.T) {
+	copyright, err := control.ParseCopyright(bufio.NewReader(strings.NewReader(testCopyright)), "")
+	isok(t, err)
+
+	assert(t, copyright.Header.UpstreamName == "hello")
+	assert(t, copyright.Header.Source == "https://example.com/hello")
+	assert(t, len(copyright.Header.FilesExcluded) == 2)
+	assert(t, copyright.Header.FilesExcluded[1] == "*.min.js")
+
+	assert(t, len(copyright.Files) == 4)
+	assert(t, len(copyright.Licenses) == 1)
+
+	lib := copyright.Files[1]
+	assert(t, len(lib.Files) == 2)
+	assert(t, lib.Files[1] == "compat/strl?.c")
+	assert(t, lib.License.Name == "MIT")
+	assert(t, strings.HasPrefix(lib.License.Text, "Permission is hereby granted"))
+	assert(t, strings.Contains(lib.License.Text, "software.\n\nThe above"))
+	assert(t, strings.Contains(lib.Copyright, "Example Corp"))
+
+	assert(t, copyright.Licenses[0].License.Name == "GPL-3+")
+
+	/* Files paragraphs can be written back out */
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, lib))
+	assert(t, strings.HasPrefix(out.String(), "Files: lib/* compat/strl?.c\n"))
+	assert(t, strings.Contains(out.String(), "License: MIT\n Permission"))
+	assert(t, strings.Contains(out.String(), "\n .\n The above"))
+
+	_, err = control.ParseCopyright(bufio.NewReader(strings.NewReader("")), "")
+	notok(t, err)
+	_, err = control.ParseCopyright(bufio.NewReader(strings.NewReader(
+		"Upstream-Name: hello\n",
+	)), "")
+	notok(t, err)
+}
+
+func TestCopyrightLicenseFor(t *testing.T) {
+	copyright, err := control.ParseCopyright(bufio.NewReader(strings.NewReader(testCopyright)), "")
+	isok(t, err)
+
+	for name, want := range map[string]string{
+		"src/hello.c":             "GPL-3+",
+		"./README":                "GPL-3+",
+		"lib/foo.c":               "MIT",
+		"lib/deep/nested/foo.c":   "MIT",
+		"compat/strlx.c":          "MIT",
+		"compat/strlcpy2.c":       "GPL-3+",
+		"lib/vendored/bar.c":      "BSD-3-Clause or GPL-3+",
+		"lib/with*star.c":         "BSD-3-Clause or GPL-3+",
+		"lib/withXstar.c":         "MIT",
+		"debian/rules":            "GPL-3+",
+		"debian/patches/01.patch": "GPL-3+",
+	} {
+		license, err := copyright.LicenseFor(name)
+		isok(t, err)
+		assert(t, license.Name == want)
+	}
+
+	/* The text comes from the stand-alone License paragraph */
+	license, err := copyright.LicenseFor("debian/rules")
+	isok(t, err)
+	assert(t, strings.HasPrefix(license.Text, "This program is free software"))
+
+	files, err := copyright.FilesFor("debian/rules")
+	isok(t, err)
+	assert(t, strings.HasPrefix(files.Copyright, "2023 Paul Tagliamonte"))
+
+	/* Changing the patterns after matching is picked up */
+	files.Files = []string{"debian/control"}
+	matches, err := files.Matches("debian/rules")
+	isok(t, err)
+	assert(t, !matches)
+	matches, err = files.Matches("debian/control")
+	isok(t, err)
+	assert(t, matches)
+
+	/* Nothing matches without the catch-all paragraph */
+	copyright.Files = copyright.Files[1:]
+	files, err = copyright.FilesFor("src/hello.c")
+	isok(t, err)
+	assert(t, files == nil)
+	_, err = copyright.LicenseFor("src/hello.c")
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -26,6 +26,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"golang.org/x/crypto/openpgp"
 )
@@ -57,7 +58,9 @@ type Unmarshallable interface {
 //
 // If you're unpacking into a list of strings, you have the option of defining
 // a string to split tokens on (`delim:", "`), and things to strip off each
-// element (`strip:"\n\r\t "`).
+// element (`strip:"\n\r\t "`). Lists which may be separated by commas,
+// whitespace, or both, can be tagged with `fields:"true"` to split on
+// either (`delim` is still used when encoding).
 //
 // If you're unpacking into a struct, the struct will be walked according to
 // the rules above. If you wish to override how this writes to the nested
@@ -268,7 +271,14 @@ func decodeStructValueSlice(field reflect.Value, fieldType reflect.StructField,
 
 	value = strings.Trim(value, strip)
 
-	for _, el := range strings.Split(value, delim) {
+	elements := strings.Split(value, delim)
+	if fieldType.Tag.Get("fields") == "true" {
+		elements = strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+	}
+
+	for _, el := range elements {
 		el = strings.Trim(el, strip)
 
 		targetValue := reflect.New(underlyingType)
@@ -111,6 +111,19 @@ ValueThree: foo bar baz
 	assert(t, foo.ValueThree[0] == "foo")
 }
 
+func TestFieldsUnmarshal(t *testing.T) {
+	foo := struct {
+		Value []string `delim:", " fields:"true"`
+	}{}
+	isok(t, control.Unmarshal(&foo, strings.NewReader(`Value: foo,bar baz,
+ qux
+`)))
+	assert(t, len(foo.Value) == 4)
+	assert(t, foo.Value[0] == "foo")
+	assert(t, foo.Value[1] == "bar")
+	assert(t, foo.Value[3] == "qux")
+}
+
 func TestRequiredUnmarshal(t *testing.T) {
 	foo := TestStruct{}
 	notok(t, control.Unmarshal(&foo, strings.NewReader(`Foo-Bar: baz
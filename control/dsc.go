@@ -23,6 +23,7 @@ package control // import "pault.ag/go/debian/control"
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -45,7 +46,7 @@ import (
 type DSC struct {
 	Paragraph
 
-	Filename string
+	Filename string `control:"-"`
 
 	Format           string
 	Source           string
@@ -62,21 +63,19 @@ type DSC struct {
 	BuildDependsArch  dependency.Dependency `control:"Build-Depends-Arch"`
 	BuildDependsIndep dependency.Dependency `control:"Build-Depends-Indep"`
 
-	ChecksumsSha1   []SHA1FileHash   `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t "`
-	ChecksumsSha256 []SHA256FileHash `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t "`
-	Files           []MD5FileHash    `control:"Files" delim:"\n" strip:"\n\r\t "`
-
-	/*
-		TODO:
-			Package-List
-	*/
+	PackageList     []PackageListEntry `control:"Package-List" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha1   []SHA1FileHash     `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256 []SHA256FileHash   `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	Files           []MD5FileHash      `control:"Files" delim:"\n" strip:"\n\r\t " multiline:"true"`
 }
 
 // Given a bunch of DSC objects, sort the packages topologically by
 // build order by looking at the relationship between the Build-Depends
 // field.
+//
+// If the Build-Depends form a cycle, a *BuildCycleError is returned,
+// which lists each cycle, and the Build-Depends that form it.
 func OrderDSCForBuild(dscs []DSC, arch dependency.Arch) ([]DSC, error) {
-	sourceMapping := map[string]string{}
 	network := topsort.NewNetwork()
 	ret := []DSC{}
 
@@ -88,30 +87,27 @@ func OrderDSCForBuild(dscs []DSC, arch dependency.Arch) ([]DSC, error) {
 	 * - return sorted list of dsc files
 	 */
 
+	sourceMapping := binarySources(dscs, arch)
 	for _, dsc := range dscs {
-		for _, binary := range dsc.Binaries {
-			sourceMapping[binary] = dsc.Source
-		}
 		network.AddNode(dsc.Source, dsc)
 	}
 
+	edges := []BuildDependsEdge{}
 	for _, dsc := range dscs {
-		concreteBuildDepends := []dependency.Possibility{}
-		concreteBuildDepends = append(concreteBuildDepends, dsc.BuildDepends.GetPossibilities(arch)...)
-		concreteBuildDepends = append(concreteBuildDepends, dsc.BuildDependsArch.GetPossibilities(arch)...)
-		concreteBuildDepends = append(concreteBuildDepends, dsc.BuildDependsIndep.GetPossibilities(arch)...)
-		for _, relation := range concreteBuildDepends {
-			if val, ok := sourceMapping[relation.Name]; ok {
-				err := network.AddEdge(val, dsc.Source)
-				if err != nil {
-					return nil, err
-				}
+		for _, edge := range buildDependsEdges(dsc, arch, nil, sourceMapping) {
+			err := network.AddEdge(edge.From, edge.To)
+			if err != nil {
+				return nil, err
 			}
+			edges = append(edges, edge)
 		}
 	}
 
 	nodes, err := network.Sort()
 	if err != nil {
+		if cycles := findBuildCycles(edges); len(cycles) != 0 {
+			return nil, &BuildCycleError{Cycles: cycles}
+		}
 		return nil, err
 	}
 
@@ -155,6 +151,25 @@ func ParseDsc(reader *bufio.Reader, path string) (*DSC, error) {
 	return &ret, nil
 }
 
+// Return the names of the binary packages this source builds on `arch`.
+// If the .dsc has a Package-List, only packages built on `arch` (or
+// arch:all packages) are returned, otherwise every package in Binary is.
+func (d *DSC) GetBinaries(arch dependency.Arch) []string {
+	ret := []string{}
+	if len(d.PackageList) == 0 {
+		for _, binary := range d.Binaries {
+			ret = append(ret, strings.TrimSpace(binary))
+		}
+		return ret
+	}
+	for _, entry := range d.PackageList {
+		if entry.BuildsOn(arch) {
+			ret = append(ret, entry.Package)
+		}
+	}
+	return ret
+}
+
 // Check to see if this .dsc contains any arch:all binary packages along
 // with any arch dependent packages.
 func (d *DSC) HasArchAll() bool {
@@ -264,4 +279,73 @@ func (d *DSC) DebianSource() (string, error) {
 	return "", fmt.Errorf("Could not find the Debian source")
 }
 
+// Check the size and checksums of every file listed in the Files,
+// Checksums-Sha1 and Checksums-Sha256 fields. This requires DSC.Filename
+// to be correctly set, and for the files to exist next to the .dsc.
+//
+// Any file name which isn't a plain name in the same directory as the
+// .dsc (such as one containing a "/" or "..") is rejected before any file
+// is opened.
+func (d *DSC) Verify() error {
+	hashes := []FileHash{}
+	for _, hash := range d.Files {
+		hashes = append(hashes, hash.FileHash)
+	}
+	for _, hash := range d.ChecksumsSha1 {
+		hashes = append(hashes, hash.FileHash)
+	}
+	for _, hash := range d.ChecksumsSha256 {
+		hashes = append(hashes, hash.FileHash)
+	}
+
+	for _, hash := range hashes {
+		if err := CheckSourceFilename(hash.Filename); err != nil {
+			return err
+		}
+	}
+
+	baseDir := filepath.Dir(d.Filename)
+	for _, hash := range hashes {
+		if err := verifyFile(path.Join(baseDir, hash.Filename), hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check that `name`, as listed in a .dsc or .changes file, is a plain
+// file name, which can't refer to a file outside of the directory the
+// .dsc or .changes is in.
+func CheckSourceFilename(name string) error {
+	if name == "" || name == "." || strings.Contains(name, "..") ||
+		strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("Invalid file name in source package: '%s'", name)
+	}
+	return nil
+}
+
+func verifyFile(path string, hash FileHash) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	verifier, err := hash.Verifier()
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(verifier, fd)
+	if err != nil {
+		return err
+	}
+	if size != hash.Size {
+		return fmt.Errorf("%s: invalid size: got %d, want %d", hash.Filename, size, hash.Size)
+	}
+	if err := verifier.Close(); err != nil {
+		return fmt.Errorf("%s: %v", hash.Filename, err)
+	}
+	return nil
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,664 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pault.ag/go/debian/changelog"
+	"pault.ag/go/debian/hashio"
+	"pault.ag/go/debian/internal"
+)
+
+// DSCBuilder {{{
+
+// Files and directories which are never included in a source tarball, as
+// is done by default by `dpkg-source`.
+var dscBuilderExcludes = map[string]bool{
+	".arch-ids":      true,
+	".bzr":           true,
+	".bzrignore":     true,
+	".cvsignore":     true,
+	".git":           true,
+	".gitattributes": true,
+	".gitignore":     true,
+	".gitmodules":    true,
+	".hg":            true,
+	".hgignore":      true,
+	".hgtags":        true,
+	".pc":            true,
+	".svn":           true,
+	"CVS":            true,
+	"RCS":            true,
+	"_darcs":         true,
+}
+
+// Fields of the Source paragraph of debian/control which are copied
+// into the `.dsc`, in addition to the Vcs-* and Build-* fields.
+var dscSourceFields = map[string]bool{
+	"Maintainer":          true,
+	"Uploaders":           true,
+	"Homepage":            true,
+	"Standards-Version":   true,
+	"Testsuite":           true,
+	"Rules-Requires-Root": true,
+}
+
+// A DSCBuilder creates the tarballs and the DSC of a source package from
+// an unpacked source tree, in the same way as `dpkg-source --build`. The
+// "3.0 (native)" and "3.0 (quilt)" formats are supported.
+type DSCBuilder struct {
+	// Root of the source tree, which contains the debian/ directory.
+	Directory string
+
+	// Parsed debian/control file.
+	Control Control
+
+	// The most recent debian/changelog entry, which sets the Version of
+	// the source package.
+	Changelog changelog.ChangelogEntry
+
+	// Source package format, either "3.0 (native)" or "3.0 (quilt)".
+	// Defaults to the contents of debian/source/format.
+	Format string
+
+	// Compression to use for the tarballs, either "gz" or "xz". Defaults
+	// to "xz".
+	Compression string
+
+	// Latest timestamp of any file in the tarballs. Files modified after
+	// it are clamped to it. Defaults to the date of the changelog entry.
+	ModTime time.Time
+
+	// For "3.0 (quilt)", create the orig tarball from everything outside
+	// of debian/ if there isn't one already. This is only correct if none
+	// of the patches in debian/patches are applied to the tree, since
+	// they'd otherwise no longer apply to the orig tarball.
+	CreateOrig bool
+}
+
+// Create a new DSCBuilder for the source tree at `directory`, by parsing
+// debian/control, debian/changelog and debian/source/format.
+func NewDSCBuilder(directory string) (*DSCBuilder, error) {
+	debianDir := filepath.Join(directory, "debian")
+
+	debControl, err := ParseControlFile(filepath.Join(debianDir, "control"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := changelog.ParseFile(filepath.Join(debianDir, "changelog"))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("No entries in debian/changelog")
+	}
+
+	format := "1.0"
+	data, err := os.ReadFile(filepath.Join(debianDir, "source", "format"))
+	if err == nil {
+		format = strings.TrimSpace(string(data))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &DSCBuilder{
+		Directory: directory,
+		Control:   *debControl,
+		Changelog: entries[0],
+		Format:    format,
+	}, nil
+}
+
+// Build {{{
+
+// Write the tarballs of the source package into `outputDir`, and return
+// the DSC describing them, ready to be written out with Marshal.
+// DSC.Filename is set to the path the `.dsc` should be written to.
+//
+// For "3.0 (quilt)", the orig tarball must already be in `outputDir`,
+// and is used as-is. If there isn't one, an error is returned, unless
+// CreateOrig is set. If the upstream files in the tree don't match the
+// orig tarball with debian/patches applied, an error is returned, since
+// those changes can't be represented in the source package.
+func (b *DSCBuilder) Build(outputDir string) (*DSC, error) {
+	source := b.Control.Source.Source
+	if source == "" {
+		source = b.Changelog.Source
+	}
+	if source != b.Changelog.Source {
+		return nil, fmt.Errorf(
+			"Source %s in debian/control doesn't match %s in debian/changelog",
+			source, b.Changelog.Source,
+		)
+	}
+	debVersion := b.Changelog.Version
+
+	compression := b.Compression
+	if compression == "" {
+		compression = "xz"
+	}
+	if compression != "gz" && compression != "xz" {
+		return nil, fmt.Errorf("Unsupported source compression: '%s'", compression)
+	}
+
+	modTime := b.ModTime
+	if modTime.IsZero() {
+		modTime = b.Changelog.When
+	}
+
+	files := []string{}
+	switch b.Format {
+	case "3.0 (native)":
+		if !debVersion.IsNative() {
+			return nil, fmt.Errorf("Native package with a Debian revision: %s", debVersion)
+		}
+		tarball := filepath.Join(outputDir, fmt.Sprintf(
+			"%s_%s.tar.%s", source, debVersion.StringWithoutEpoch(), compression,
+		))
+		prefix := fmt.Sprintf("%s-%s", source, debVersion.Version)
+		if err := writeSourceTarball(tarball, compression, b.Directory, prefix, modTime, nil); err != nil {
+			return nil, err
+		}
+		files = append(files, tarball)
+	case "3.0 (quilt)":
+		if debVersion.IsNative() {
+			return nil, fmt.Errorf("Non-native package without a Debian revision: %s", debVersion)
+		}
+		orig, err := b.findOrig(outputDir, source)
+		if err != nil {
+			return nil, err
+		}
+		if orig == "" && !b.CreateOrig {
+			return nil, fmt.Errorf(
+				"No orig tarball for %s %s in %s",
+				source, debVersion.Version, outputDir,
+			)
+		}
+		if orig == "" {
+			orig = filepath.Join(outputDir, fmt.Sprintf(
+				"%s_%s.orig.tar.%s", source, debVersion.Version, compression,
+			))
+			prefix := fmt.Sprintf("%s-%s", source, debVersion.Version)
+			skipDebian := func(name string) bool { return name == "debian" }
+			if err := writeSourceTarball(orig, compression, b.Directory, prefix, modTime, skipDebian); err != nil {
+				return nil, err
+			}
+		} else if err := checkUpstreamChanges(orig, b.Directory); err != nil {
+			return nil, err
+		}
+		tarball := filepath.Join(outputDir, fmt.Sprintf(
+			"%s_%s.debian.tar.%s", source, debVersion.StringWithoutEpoch(), compression,
+		))
+		if err := writeSourceTarball(
+			tarball, compression, filepath.Join(b.Directory, "debian"), "debian", modTime, nil,
+		); err != nil {
+			return nil, err
+		}
+		files = append(files, orig, tarball)
+	default:
+		return nil, fmt.Errorf("Unsupported source format: '%s'", b.Format)
+	}
+
+	para := b.paragraph(source)
+	dsc := DSC{}
+	if err := UnpackFromParagraph(para, &dsc); err != nil {
+		return nil, err
+	}
+	dsc.Filename = filepath.Join(outputDir, fmt.Sprintf(
+		"%s_%s.dsc", source, debVersion.StringWithoutEpoch(),
+	))
+
+	for _, path := range files {
+		if err := addDSCFile(&dsc, path); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dsc, nil
+}
+
+// }}}
+
+// Internals {{{
+
+// Look for an existing orig tarball for this version in `dir`.
+func (b *DSCBuilder) findOrig(dir, source string) (string, error) {
+	for _, compression := range []string{"gz", "xz", "bz2", "lzma"} {
+		path := filepath.Join(dir, fmt.Sprintf(
+			"%s_%s.orig.tar.%s", source, b.Changelog.Version.Version, compression,
+		))
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Check that the upstream files (everything outside of debian/) in the
+// tree at `directory` are the same as the orig tarball at `orig` once the
+// patches in debian/patches have been applied to it. Any other changes to
+// the tree can't be represented by a "3.0 (quilt)" source package, and
+// would be silently dropped from it, so dpkg-source refuses to build it.
+func checkUpstreamChanges(orig, directory string) error {
+	unpacked, err := os.MkdirTemp("", "dscbuild-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(unpacked)
+
+	symlinks, err := unpackOrig(orig, unpacked)
+	if err != nil {
+		return err
+	}
+	if err := internal.ApplySeries(unpacked, directory); err != nil {
+		return fmt.Errorf("Can't apply debian/patches to %s: %w", filepath.Base(orig), err)
+	}
+
+	want, err := upstreamFiles(unpacked)
+	if err != nil {
+		return err
+	}
+	for name, target := range symlinks {
+		want[name] = "-> " + target
+	}
+	got, err := upstreamFiles(directory)
+	if err != nil {
+		return err
+	}
+
+	changed := []string{}
+	for name, hash := range got {
+		if want[name] != hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	return fmt.Errorf(
+		"Unrepresentable changes to upstream files, which aren't in debian/patches: %s",
+		strings.Join(changed, ", "),
+	)
+}
+
+// Unpack the regular files and directories of the orig tarball at `orig`
+// into `dest`, removing the leading directory from every name. Symlinks
+// aren't created, and are returned instead, keyed by their path.
+func unpackOrig(orig, dest string) (map[string]string, error) {
+	fd, err := os.Open(orig)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	decompressor, err := hashio.GetDecompressor(strings.TrimPrefix(filepath.Ext(orig), "."))
+	if err != nil {
+		return nil, err
+	}
+	decompressed, err := decompressor(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressed.Close()
+
+	symlinks := map[string]string{}
+	archive := tar.NewReader(decompressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return symlinks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, name, _ := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		name = strings.TrimSuffix(name, "/")
+		if name == "" {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("%s: invalid name %s", filepath.Base(orig), header.Name)
+		}
+		path := filepath.Join(dest, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return nil, err
+			}
+			out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := io.Copy(out, archive); err != nil {
+				out.Close()
+				return nil, err
+			}
+			if err := out.Close(); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink:
+			symlinks[name] = header.Linkname
+		}
+	}
+}
+
+// Return the upstream files of the tree at `root`, keyed by their path,
+// with the SHA256 of each regular file, or the target of each symlink.
+// The debian/ directory, and anything dpkg-source ignores, is skipped.
+func upstreamFiles(root string) (map[string]string, error) {
+	ret := map[string]string{}
+	err := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if rel != "." && (dscBuilderExcludes[entry.Name()] || rel == "debian") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			ret[filepath.ToSlash(rel)] = "-> " + target
+		case entry.Type().IsRegular():
+			fd, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer fd.Close()
+			hasher, err := hashio.NewHasher("sha256")
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(hasher, fd); err != nil {
+				return err
+			}
+			ret[filepath.ToSlash(rel)] = fmt.Sprintf("%x", hasher.Sum(nil))
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// Create the Paragraph of the `.dsc`, in the order used by dpkg-source,
+// with every field except the Checksums-* and Files fields.
+func (b *DSCBuilder) paragraph(source string) Paragraph {
+	para := Paragraph{Order: []string{}, Values: map[string]string{}}
+
+	binaries := []string{}
+	arches := []string{}
+	seenArches := map[string]bool{}
+	for _, binary := range b.Control.Binaries {
+		binaries = append(binaries, binary.Package)
+		for _, arch := range strings.Fields(binary.Values["Architecture"]) {
+			if !seenArches[arch] {
+				seenArches[arch] = true
+				arches = append(arches, arch)
+			}
+		}
+	}
+
+	para.Set("Format", b.Format)
+	para.Set("Source", source)
+	para.Set("Binary", strings.Join(binaries, ", "))
+	para.Set("Architecture", strings.Join(arches, " "))
+	para.Set("Version", b.Changelog.Version.String())
+
+	for _, key := range b.Control.Source.Order {
+		value := b.Control.Source.Values[key]
+		switch {
+		case strings.HasPrefix(key, "XS-"):
+			para.Set(key[3:], value)
+		case strings.HasPrefix(key, "XSC-"):
+			para.Set(key[4:], value)
+		case dscSourceFields[key],
+			strings.HasPrefix(key, "Vcs-"),
+			strings.HasPrefix(key, "Build-"):
+			para.Set(key, value)
+		}
+	}
+
+	if _, ok := para.Values["Testsuite"]; !ok {
+		testsControl := filepath.Join(b.Directory, "debian", "tests", "control")
+		if _, err := os.Stat(testsControl); err == nil {
+			para.Set("Testsuite", "autopkgtest")
+		}
+	}
+
+	packageList := []string{}
+	for _, binary := range b.Control.Binaries {
+		packageList = append(packageList, b.packageListEntry(binary))
+	}
+	para.Set("Package-List", "\n"+strings.Join(packageList, "\n"))
+
+	return para
+}
+
+// Format a line of the Package-List field for a binary package.
+func (b *DSCBuilder) packageListEntry(binary BinaryParagraph) string {
+	packageType := binary.Values["Package-Type"]
+	if packageType == "" {
+		packageType = "deb"
+	}
+	section := binary.Section
+	if section == "" {
+		section = b.Control.Source.Section
+	}
+	priority := binary.Priority
+	if priority == "" {
+		priority = b.Control.Source.Priority
+	}
+
+	entry := fmt.Sprintf(
+		"%s %s %s %s arch=%s",
+		binary.Package, packageType, internal.OrDash(section), internal.OrDash(priority),
+		strings.Join(strings.Fields(binary.Values["Architecture"]), ","),
+	)
+
+	/* Build-Profiles: <!nocheck> <stage1 cross> => profile=!nocheck,stage1+cross */
+	if profiles := binary.Values["Build-Profiles"]; profiles != "" {
+		lists := []string{}
+		for _, list := range strings.Split(profiles, ">") {
+			list = strings.Trim(list, "\n\r\t <")
+			if list != "" {
+				lists = append(lists, strings.Join(strings.Fields(list), "+"))
+			}
+		}
+		entry = entry + " profile=" + strings.Join(lists, ",")
+	}
+	if binary.Essential {
+		entry = entry + " essential=yes"
+	}
+	return entry
+}
+
+// Hash the file at `path`, and add it to the Checksums-Sha1,
+// Checksums-Sha256 and Files fields of `dsc`.
+func addDSCFile(dsc *DSC, path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	reader, hashers, err := hashio.NewHasherReaders(
+		[]string{"md5", "sha1", "sha256"},
+		fd,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return err
+	}
+
+	filename := filepath.Base(path)
+	dsc.Files = append(dsc.Files, MD5FileHash{
+		FileHash: FileHashFromHasher(filename, *hashers[0]),
+	})
+	dsc.ChecksumsSha1 = append(dsc.ChecksumsSha1, SHA1FileHash{
+		FileHash: FileHashFromHasher(filename, *hashers[1]),
+	})
+	dsc.ChecksumsSha256 = append(dsc.ChecksumsSha256, SHA256FileHash{
+		FileHash: FileHashFromHasher(filename, *hashers[2]),
+	})
+	return nil
+}
+
+// Write a tarball of the directory `root` to `path`, with every entry
+// under `prefix`, owned by root, in sorted order, and with timestamps
+// clamped to `modTime`. Entries named in dscBuilderExcludes, and top
+// level entries for which `skip` returns true, are left out.
+func writeSourceTarball(
+	path, compression, root, prefix string,
+	modTime time.Time,
+	skip func(name string) bool,
+) error {
+	compressor, err := hashio.GetCompressor(compression)
+	if err != nil {
+		return err
+	}
+
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	compressed, err := compressor(fd)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewWriter(compressed)
+
+	/* WalkDir visits entries in lexical order, so the output is stable */
+	err = filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if rel != "." && (dscBuilderExcludes[entry.Name()] ||
+			(skip != nil && !strings.Contains(rel, string(filepath.Separator)) && skip(rel))) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		header.Name = prefix + "/"
+		if rel != "." {
+			header.Name = prefix + "/" + filepath.ToSlash(rel)
+		}
+		if info.IsDir() && rel != "." {
+			header.Name = header.Name + "/"
+		}
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "root", "root"
+		header.Format = tar.FormatGNU
+		header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+		if header.ModTime.After(modTime) {
+			header.ModTime = modTime
+		}
+		header.ModTime = header.ModTime.Truncate(time.Second)
+
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+		_, err = io.Copy(archive, data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// }}}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,250 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// Test Source Tree {{{
+const testSourceControl = `Source: hello
+Section: devel
+Priority: optional
+Maintainer: Paul Tagliamonte <paultag@debian.org>
+Build-Depends: debhelper-compat (= 13),
+ libfoo-dev <!nocheck>
+Standards-Version: 4.6.2
+Homepage: https://example.com/hello
+Vcs-Git: https://salsa.debian.org/debian/hello.git
+XS-Go-Import-Path: example.com/hello
+
+Package: hello
+Architecture: any
+Depends: ${shlibs:Depends}, ${misc:Depends}
+Description: example package
+ This is an example package.
+
+Package: hello-doc
+Architecture: all
+Section: doc
+Build-Profiles: <!nodoc> <stage1 cross>
+Description: example package (documentation)
+ This is the documentation.
+`
+
+func writeTestSourceTree(t *testing.T, version, format string) string {
+	dir := t.TempDir()
+	tree := filepath.Join(dir, "hello")
+	files := map[string]string{
+		"debian/control":       testSourceControl,
+		"debian/source/format": format + "\n",
+		"debian/tests/control": "Test-Command: hello\n",
+		"debian/changelog": "hello (" + version + ") unstable; urgency=medium\n\n" +
+			"  * Initial release.\n\n" +
+			" -- Paul Tagliamonte <paultag@debian.org>  Tue, 14 Nov 2023 22:13:20 +0000\n",
+		"src/hello.c": "int main() { return 0; }\n",
+		".git/HEAD":   "ref: refs/heads/main\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tree, name)
+		isok(t, os.MkdirAll(filepath.Dir(path), 0755))
+		isok(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return tree
+}
+
+// }}}
+
+func readTestTarball(t *testing.T, path string) []string {
+	fd, err := os.Open(path)
+	isok(t, err)
+	defer fd.Close()
+	decompressed, err := gzip.NewReader(fd)
+	isok(t, err)
+
+	names := []string{}
+	archive := tar.NewReader(decompressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return names
+		}
+		isok(t, err)
+		assert(t, header.Uid == 0 && header.Uname == "root")
+		assert(t, header.ModTime.Unix() <= 1700000000)
+		names = append(names, header.Name)
+	}
+}
+
+func TestDSCBuilderQuilt(t *testing.T) {
+	tree := writeTestSourceTree(t, "1:1.0-1", "3.0 (quilt)")
+	builder, err := control.NewDSCBuilder(tree)
+	isok(t, err)
+	assert(t, builder.Format == "3.0 (quilt)")
+	builder.Compression = "gz"
+
+	/* Without an orig tarball, one is only created when asked for */
+	outputDir := filepath.Dir(tree)
+	_, err = builder.Build(outputDir)
+	notok(t, err)
+
+	builder.CreateOrig = true
+	dsc, err := builder.Build(outputDir)
+	isok(t, err)
+	assert(t, dsc.Filename == filepath.Join(outputDir, "hello_1.0-1.dsc"))
+	assert(t, dsc.Source == "hello")
+	assert(t, dsc.Version.String() == "1:1.0-1")
+	assert(t, len(dsc.Binaries) == 2)
+	assert(t, len(dsc.Architectures) == 2)
+	assert(t, dsc.Architectures[0].String() == "any")
+	assert(t, dsc.HasArchAll())
+	assert(t, dsc.StandardsVersion == "4.6.2")
+	assert(t, len(dsc.BuildDepends.Relations) == 2)
+
+	assert(t, len(dsc.Files) == 2)
+	assert(t, dsc.Files[0].Filename == "hello_1.0.orig.tar.gz")
+	assert(t, dsc.Files[1].Filename == "hello_1.0-1.debian.tar.gz")
+	assert(t, len(dsc.ChecksumsSha256) == 2)
+	for _, file := range dsc.AbsFiles() {
+		info, err := os.Stat(file.Filename)
+		isok(t, err)
+		assert(t, info.Size() == file.Size)
+	}
+
+	orig := readTestTarball(t, filepath.Join(outputDir, "hello_1.0.orig.tar.gz"))
+	assert(t, len(orig) == 3)
+	assert(t, orig[0] == "hello-1.0/")
+	assert(t, orig[1] == "hello-1.0/src/")
+	assert(t, orig[2] == "hello-1.0/src/hello.c")
+
+	debian := readTestTarball(t, filepath.Join(outputDir, "hello_1.0-1.debian.tar.gz"))
+	assert(t, len(debian) == 7)
+	assert(t, debian[0] == "debian/")
+	assert(t, debian[1] == "debian/changelog")
+
+	/* Check that the .dsc can be written out and read back in */
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, dsc))
+	parsed, err := control.ParseDsc(bufio.NewReader(&out), dsc.Filename)
+	isok(t, err)
+	assert(t, parsed.Format == "3.0 (quilt)")
+	assert(t, parsed.Values["Go-Import-Path"] == "example.com/hello")
+	assert(t, parsed.Values["Vcs-Git"] == "https://salsa.debian.org/debian/hello.git")
+	assert(t, parsed.Values["Testsuite"] == "autopkgtest")
+	assert(t, parsed.Values["Package-List"] ==
+		"hello deb devel optional arch=any\n"+
+			"hello-doc deb doc optional arch=all profile=!nodoc,stage1+cross\n")
+	assert(t, len(parsed.Files) == 2)
+	assert(t, parsed.Files[1].Hash == dsc.Files[1].Hash)
+	_, ok := parsed.Values["Filename"]
+	assert(t, !ok)
+
+	/* An existing orig tarball is reused */
+	builder.CreateOrig = false
+	reused, err := builder.Build(outputDir)
+	isok(t, err)
+	assert(t, reused.Files[0].Hash == dsc.Files[0].Hash)
+}
+
+func TestDSCBuilderQuiltUpstreamChanges(t *testing.T) {
+	tree := writeTestSourceTree(t, "1.0-1", "3.0 (quilt)")
+	builder, err := control.NewDSCBuilder(tree)
+	isok(t, err)
+	builder.Compression = "gz"
+	builder.CreateOrig = true
+	outputDir := filepath.Dir(tree)
+	_, err = builder.Build(outputDir)
+	isok(t, err)
+
+	/* Changes to upstream files can't be represented without a patch */
+	hello := filepath.Join(tree, "src", "hello.c")
+	isok(t, os.WriteFile(hello, []byte("int main() { return 1; }\n"), 0644))
+	_, err = builder.Build(outputDir)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "src/hello.c"))
+
+	/* Nor can new or removed upstream files */
+	isok(t, os.WriteFile(hello, []byte("int main() { return 0; }\n"), 0644))
+	isok(t, os.WriteFile(filepath.Join(tree, "NEWS"), []byte("news\n"), 0644))
+	_, err = builder.Build(outputDir)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "NEWS"))
+	isok(t, os.Remove(filepath.Join(tree, "NEWS")))
+	isok(t, os.Remove(hello))
+	_, err = builder.Build(outputDir)
+	notok(t, err)
+
+	/* Once the change is in debian/patches, the tree can be built */
+	isok(t, os.WriteFile(hello, []byte("int main() { return 1; }\n"), 0644))
+	isok(t, os.MkdirAll(filepath.Join(tree, "debian", "patches"), 0755))
+	isok(t, os.WriteFile(filepath.Join(tree, "debian", "patches", "series"), []byte("fail.patch\n"), 0644))
+	isok(t, os.WriteFile(filepath.Join(tree, "debian", "patches", "fail.patch"), []byte(`--- a/src/hello.c
++++ b/src/hello.c
+@@ -1 +1 @@
+-int main() { return 0; }
++int main() { return 1; }
+`), 0644))
+	_, err = builder.Build(outputDir)
+	isok(t, err)
+}
+
+func TestDSCBuilderNative(t *testing.T) {
+	tree := writeTestSourceTree(t, "1.0", "3.0 (native)")
+	builder, err := control.NewDSCBuilder(tree)
+	isok(t, err)
+	builder.Compression = "gz"
+
+	outputDir := filepath.Dir(tree)
+	dsc, err := builder.Build(outputDir)
+	isok(t, err)
+	assert(t, len(dsc.Files) == 1)
+	assert(t, dsc.Files[0].Filename == "hello_1.0.tar.gz")
+
+	names := readTestTarball(t, filepath.Join(outputDir, "hello_1.0.tar.gz"))
+	assert(t, len(names) == 10)
+	assert(t, names[0] == "hello-1.0/")
+	assert(t, names[1] == "hello-1.0/debian/")
+
+	/* Native packages can't have a Debian revision */
+	builder.Changelog.Version.Revision = "1"
+	_, err = builder.Build(outputDir)
+	notok(t, err)
+
+	builder.Format = "1.0"
+	_, err = builder.Build(outputDir)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -89,6 +89,10 @@ func convertToParagraph(data reflect.Value) (*Paragraph, error) {
 			continue
 		}
 
+		if fieldType.Tag.Get("omitempty") == "true" && field.IsZero() {
+			continue
+		}
+
 		data, err := marshalStructValue(field, fieldType)
 		if err != nil {
 			return nil, err
@@ -206,6 +210,10 @@ func marshalStructValueSlice(field reflect.Value, fieldType reflect.StructField)
 // If you're dehydrating a list of strings, you have the option of defining
 // a string to join the tokens with (`delim:", "`).
 //
+// Empty strings and lists are not written out, but `bool` and `int` values
+// always are (as "no" and "0"), unless the field is tagged with
+// `omitempty:"true"`.
+//
 // In order to Marshal a custom Struct, you are required to implement the
 // Marshallable interface. It's highly encouraged to put this interface on
 // the struct without a pointer receiver, so that pass-by-value works
@@ -243,6 +251,10 @@ func Marshal(writer io.Writer, data interface{}) error {
 // If you're dehydrating a list of strings, you have the option of defining
 // a string to join the tokens with (`delim:", "`).
 //
+// Empty strings and lists are not written out, but `bool` and `int` values
+// always are (as "no" and "0"), unless the field is tagged with
+// `omitempty:"true"`.
+//
 // In order to Marshal a custom Struct, you are required to implement the
 // Marshallable interface. It's highly encouraged to put this interface on
 // the struct without a pointer receiver, so that pass-by-value works
@@ -112,6 +112,21 @@ A Test`}
 `)
 }
 
+func TestMultilineRoundTrip(t *testing.T) {
+	input := `Foo: Hello
+ This
+ .
+ Is A Test
+X-A-Test: Foo
+`
+	el := TestParaMarshalStruct{}
+	isok(t, control.Unmarshal(&el, strings.NewReader(input)))
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == input)
+}
+
 type boolStruct struct {
 	ExtraSourceOnly bool `control:"Extra-Source-Only"`
 }
@@ -136,4 +151,24 @@ func TestBoolMarshal(t *testing.T) {
 `)
 }
 
+type omitEmptyStruct struct {
+	Essential     bool `omitempty:"true"`
+	InstalledSize int  `control:"Installed-Size" omitempty:"true"`
+	Priority      int
+}
+
+func TestOmitEmptyMarshal(t *testing.T) {
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, omitEmptyStruct{}))
+	assert(t, writer.String() == `Priority: 0
+`)
+
+	writer = bytes.Buffer{}
+	isok(t, control.Marshal(&writer, omitEmptyStruct{Essential: true, InstalledSize: 10}))
+	assert(t, writer.String() == `Essential: yes
+Installed-Size: 10
+Priority: 0
+`)
+}
+
 // vim: foldmethod=marker
@@ -22,6 +22,8 @@ package control // import "pault.ag/go/debian/control"
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
@@ -96,6 +98,10 @@ func (v *verifier) Close() error {
 func (c *FileHash) Verifier() (io.WriteCloser, error) {
 	var h hash.Hash
 	switch c.Algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
 	case "sha256":
 		h = sha256.New()
 	case "sha512":
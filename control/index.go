@@ -22,9 +22,15 @@ package control // import "pault.ag/go/debian/control"
 
 import (
 	"bufio"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/hashio"
 	"pault.ag/go/debian/version"
 )
 
@@ -90,6 +96,12 @@ func (index *BinaryIndex) GetPreDepends() dependency.Dependency {
 	return index.getOptionalDependencyField("Pre-Depends")
 }
 
+// Parse the Provides relation on this package, which lists the virtual
+// packages (optionally with an exact version) that this package provides.
+func (index *BinaryIndex) GetProvides() dependency.Dependency {
+	return index.getOptionalDependencyField("Provides")
+}
+
 // Parse the Built-Depends relation on this package.
 func (index *BinaryIndex) GetBuiltUsing() dependency.Dependency {
 	return index.getOptionalDependencyField("Built-Using")
@@ -162,13 +174,14 @@ type SourceIndex struct {
 
 	StandardsVersion string
 	Format           string
-	Files            []MD5FileHash    `delim:"\n" strip:"\n\r\t "`
-	VcsBrowser       string           `control:"Vcs-Browser"`
-	VcsGit           string           `control:"Vcs-Git"`
-	VcsSvn           string           `control:"Vcs-Svn"`
-	VcsBzr           string           `control:"Vcs-Bzr"`
-	ChecksumsSha1    []SHA1FileHash   `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t "`
-	ChecksumsSha256  []SHA256FileHash `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t "`
+	Files            []MD5FileHash      `delim:"\n" strip:"\n\r\t " multiline:"true"`
+	VcsBrowser       string             `control:"Vcs-Browser"`
+	VcsGit           string             `control:"Vcs-Git"`
+	VcsSvn           string             `control:"Vcs-Svn"`
+	VcsBzr           string             `control:"Vcs-Bzr"`
+	ChecksumsSha1    []SHA1FileHash     `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256  []SHA256FileHash   `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	PackageList      []PackageListEntry `control:"Package-List" delim:"\n" strip:"\n\r\t " multiline:"true"`
 	Homepage         string
 	Directory        string
 	Priority         string
@@ -190,6 +203,93 @@ func (index *SourceIndex) GetBuildDependsIndep() dependency.Dependency {
 	return index.getOptionalDependencyField("Build-Depends-Indep")
 }
 
+// Given a parsed DSC (which must have DSC.Filename set to the location of
+// the .dsc on the filesystem), and the directory the source package is
+// stored in (relative to the archive root, such as "pool/main/h/hello"),
+// create a SourceIndex entry suitable for writing out to a Sources file.
+//
+// As done by dak and apt-ftparchive, the Source field is renamed to
+// Package, the .dsc itself is added to the Files and Checksums-* lists,
+// and the Directory field is set. All other fields of the .dsc are carried
+// over as-is. Priority and Section are not set, since those come from the
+// archive overrides, and not from the .dsc.
+func SourceIndexFromDsc(dsc *DSC, directory string) (*SourceIndex, error) {
+	hashes, err := hashSourceFile(dsc.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	para := Paragraph{
+		Order:  []string{},
+		Values: map[string]string{},
+	}
+	para.Set("Package", dsc.Source)
+	for _, key := range dsc.Paragraph.Order {
+		if key == "Source" {
+			continue
+		}
+		para.Set(key, dsc.Paragraph.Values[key])
+	}
+
+	for i, key := range []string{
+		"Files", "Checksums-Sha1", "Checksums-Sha256", "Checksums-Sha512",
+	} {
+		if _, ok := para.Values[key]; !ok && key == "Checksums-Sha512" {
+			/* Only list the Sha512 if the .dsc did */
+			continue
+		}
+		if err := prependFileHash(&para, key, hashes[i]); err != nil {
+			return nil, err
+		}
+	}
+	para.Set("Directory", directory)
+
+	ret := SourceIndex{}
+	if err := UnpackFromParagraph(para, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// hashSourceFile reads the file at `path`, and returns the md5, sha1,
+// sha256 and sha512 FileHash entries (in that order) for the file, using
+// the basename of the file as the Filename.
+func hashSourceFile(path string) ([]FileHash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, hashers, err := hashio.NewHasherReaders(
+		[]string{"md5", "sha1", "sha256", "sha512"},
+		f,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, err
+	}
+
+	ret := []FileHash{}
+	for _, hasher := range hashers {
+		ret = append(ret, FileHashFromHasher(filepath.Base(path), *hasher))
+	}
+	return ret, nil
+}
+
+// prependFileHash adds the FileHash as the first entry of the list of files
+// under the `key` of the Paragraph.
+func prependFileHash(para *Paragraph, key string, hash FileHash) error {
+	line, err := hash.marshalControl()
+	if err != nil {
+		return err
+	}
+	para.Set(key, line+"\n"+strings.TrimLeft(para.Values[key], "\n"))
+	return nil
+}
+
 // Given a reader, parse out a list of BinaryIndex structs.
 func ParseBinaryIndex(reader *bufio.Reader) (ret []BinaryIndex, err error) {
 	ret = []BinaryIndex{}
@@ -204,4 +304,75 @@ func ParseSourceIndex(reader *bufio.Reader) (ret []SourceIndex, err error) {
 	return ret, err
 }
 
+// DescriptionMD5 returns the value of the Description-md5 field for the
+// given (parsed) Description, as computed by dak and apt-ftparchive. This
+// is the MD5 of the Description as it was written in the control file,
+// continuation lines and all, with a trailing newline.
+func DescriptionMD5(description string) string {
+	lines := strings.Split(strings.TrimSuffix(description, "\n"), "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] == "" {
+			lines[i] = " ."
+		} else {
+			lines[i] = " " + lines[i]
+		}
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(lines, "\n")+"\n")))
+}
+
+// IndexWriter {{{
+
+// An IndexWriter streams index entries (such as BinaryIndex or SourceIndex
+// structs) out to an `io.Writer` as an APT index file, such as Packages or
+// Sources, optionally compressing the output.
+type IndexWriter struct {
+	encoder    *Encoder
+	compressor io.WriteCloser
+}
+
+// Create a new IndexWriter, which will write to the given `io.Writer`,
+// compressed with the named hashio Compressor (such as "gz" or "xz"). If
+// `compression` is an empty string, the index will be written uncompressed.
+//
+// The caller must call Close() when done, to flush out any compressed
+// data.
+func NewIndexWriter(writer io.Writer, compression string) (*IndexWriter, error) {
+	ret := IndexWriter{}
+
+	if compression != "" {
+		compressor, err := hashio.GetCompressor(compression)
+		if err != nil {
+			return nil, err
+		}
+		ret.compressor, err = compressor(writer)
+		if err != nil {
+			return nil, err
+		}
+		writer = ret.compressor
+	}
+
+	encoder, err := NewEncoder(writer)
+	if err != nil {
+		return nil, err
+	}
+	ret.encoder = encoder
+	return &ret, nil
+}
+
+// Write the given entry (or list of entries) out to the index.
+func (w *IndexWriter) Encode(incoming interface{}) error {
+	return w.encoder.Encode(incoming)
+}
+
+// Flush and close the compressor (if any). This does *not* close the
+// underlying `io.Writer`.
+func (w *IndexWriter) Close() error {
+	if w.compressor != nil {
+		return w.compressor.Close()
+	}
+	return nil
+}
+
+// }}}
+
 // vim: foldmethod=marker
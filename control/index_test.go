@@ -22,6 +22,12 @@ package control_test
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -263,4 +269,132 @@ Description-md5: d05e72aec9e53ee776fc0735e135889b
 	assert(t, conflicts[0].Version.Operator == ">=")
 }
 
+func TestDescriptionMD5(t *testing.T) {
+	// Test Description {{{
+	para := struct{ Description string }{}
+	isok(t, control.Unmarshal(&para, strings.NewReader(`Description: add and remove users and groups
+ This package includes the 'adduser' and 'deluser' commands for creating
+ and removing users.
+ .
+  - 'adduser' creates new users and groups and adds existing users to
+    existing groups;
+  - 'deluser' removes users and groups and removes users from a given
+    group.
+ .
+ Adding users with 'adduser' is much easier than adding them manually.
+ 'Adduser' will choose UID and GID values that conform to Debian policy,
+ create a home directory, copy skeletal user configuration, and
+ automate setting initial values for the user's password, real name
+ and so on.
+ .
+ 'Deluser' can back up and remove users' home directories
+ and mail spool or all the files they own on the system.
+ .
+ A custom script can be executed after each of the commands.
+ .
+ 'Adduser' and 'Deluser' are intended to be used by the local
+ administrator in lieu of the tools from the 'useradd' suite, and
+ they provide support for easy use from Debian package maintainer
+ scripts, functioning as kind of a policy layer to make those scripts
+ easier and more stable to write and maintain.
+`)))
+	// }}}
+	assert(t, control.DescriptionMD5(para.Description) == "a5681e7bad8d90695043c6eab9784701")
+}
+
+func TestIndexWriter(t *testing.T) {
+	indices := []control.BinaryIndex{}
+	for _, name := range []string{"foo", "bar"} {
+		index := control.BinaryIndex{}
+		isok(t, control.Unmarshal(&index, strings.NewReader(`Package: `+name+`
+Version: 1.0-1
+Architecture: amd64
+Installed-Size: 10
+Size: 1024
+`)))
+		indices = append(indices, index)
+	}
+
+	buf := bytes.Buffer{}
+	writer, err := control.NewIndexWriter(&buf, "gz")
+	isok(t, err)
+	for _, index := range indices {
+		isok(t, writer.Encode(index))
+	}
+	isok(t, writer.Close())
+
+	gzReader, err := gzip.NewReader(&buf)
+	isok(t, err)
+	parsed, err := control.ParseBinaryIndex(bufio.NewReader(gzReader))
+	isok(t, err)
+	assert(t, len(parsed) == 2)
+	assert(t, parsed[0].Package == "foo")
+	assert(t, parsed[1].Package == "bar")
+	assert(t, parsed[1].Size == 1024)
+
+	_, err = control.NewIndexWriter(&buf, "rar")
+	notok(t, err)
+}
+
+func TestSourceIndexFromDsc(t *testing.T) {
+	// Test DSC {{{
+	dscContents := `Format: 3.0 (quilt)
+Source: fbautostart
+Binary: fbautostart
+Architecture: any
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Homepage: https://launchpad.net/fbautostart
+Standards-Version: 3.9.3
+Build-Depends: debhelper (>= 9)
+Package-List:
+ fbautostart deb misc optional arch=any
+Checksums-Sha1:
+ bc36310c15edc9acf48f0a1daf548bcc6f861372 92748 fbautostart_2.718281828.orig.tar.gz
+ eaed7f053dce48d4ad4e442bbb0da73ea1181a26 2356 fbautostart_2.718281828-1.debian.tar.xz
+Checksums-Sha256:
+ bb2fdfd4a38505905222ee02d8236a594bdf6eaefca23462294cacda631745c1 92748 fbautostart_2.718281828.orig.tar.gz
+ f7186d1bebde403527b5b3fd80406decaaf295366206667d5b402da962f0b772 2356 fbautostart_2.718281828-1.debian.tar.xz
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+ f58c0e0bf4d56461e776232484c07301 2356 fbautostart_2.718281828-1.debian.tar.xz
+`
+	// }}}
+	path := filepath.Join(t.TempDir(), "fbautostart_2.718281828-1.dsc")
+	isok(t, os.WriteFile(path, []byte(dscContents), 0644))
+
+	dsc, err := control.ParseDscFile(path)
+	isok(t, err)
+
+	index, err := control.SourceIndexFromDsc(dsc, "pool/main/f/fbautostart")
+	isok(t, err)
+
+	assert(t, index.Package == "fbautostart")
+	assert(t, index.Directory == "pool/main/f/fbautostart")
+	assert(t, index.Version.String() == "2.718281828-1")
+	assert(t, len(index.Files) == 3)
+	assert(t, len(index.ChecksumsSha1) == 3)
+	assert(t, len(index.ChecksumsSha256) == 3)
+	assert(t, index.Files[0].Filename == "fbautostart_2.718281828-1.dsc")
+	assert(t, index.Files[0].Hash == fmt.Sprintf("%x", md5.Sum([]byte(dscContents))))
+	assert(t, index.Files[0].Size == int64(len(dscContents)))
+	assert(t, index.Files[1].Filename == "fbautostart_2.718281828.orig.tar.gz")
+	assert(t, index.ChecksumsSha256[0].Filename == "fbautostart_2.718281828-1.dsc")
+
+	buildDepends := index.GetBuildDepends()
+	assert(t, buildDepends.Relations[0].Possibilities[0].Name == "debhelper")
+
+	/* And make sure it survives a trip through a Sources file */
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, index))
+	assert(t, strings.HasPrefix(writer.String(), "Package: fbautostart\n"))
+	assert(t, !strings.Contains(writer.String(), "Source:"))
+
+	sources, err := control.ParseSourceIndex(bufio.NewReader(&writer))
+	isok(t, err)
+	assert(t, len(sources) == 1)
+	assert(t, len(sources[0].Files) == 3)
+	assert(t, sources[0].Files[0].Hash == index.Files[0].Hash)
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,174 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+)
+
+// PackageListEntry {{{
+
+// A PackageListEntry is a line of the Package-List field of a .dsc or
+// Sources index, which describes one of the binary packages built by the
+// source package, such as:
+//
+//	hello deb devel optional arch=any profile=!nocheck
+type PackageListEntry struct {
+	Package  string
+	Type     string
+	Section  string
+	Priority string
+
+	// Architectures the package is built on, from the "arch=" option.
+	// This may contain wildcards, such as "any" or "linux-any".
+	Architectures []dependency.Arch
+
+	// Build profiles the package is built with, from the "profile="
+	// option, as a restriction formula.
+	Profiles []dependency.StageSet
+
+	// Any other key=value options, such as "essential=yes".
+	Options map[string]string
+}
+
+func (e *PackageListEntry) UnmarshalControl(data string) error {
+	fields := strings.Fields(data)
+	if len(fields) < 4 {
+		return fmt.Errorf("Error: Unknown Package-List line: '%s'", data)
+	}
+	*e = PackageListEntry{
+		Package:       fields[0],
+		Type:          fields[1],
+		Section:       fields[2],
+		Priority:      fields[3],
+		Architectures: []dependency.Arch{},
+		Profiles:      []dependency.StageSet{},
+		Options:       map[string]string{},
+	}
+
+	for _, option := range fields[4:] {
+		key, value, found := strings.Cut(option, "=")
+		if !found {
+			return fmt.Errorf("Error: Malformed Package-List option: '%s'", option)
+		}
+		switch key {
+		case "arch":
+			for _, name := range strings.Split(value, ",") {
+				arch, err := dependency.ParseArch(name)
+				if err != nil {
+					return err
+				}
+				e.Architectures = append(e.Architectures, *arch)
+			}
+		case "profile":
+			/* profile=!nocheck,stage1+cross is <!nocheck> <stage1 cross> */
+			for _, terms := range strings.Split(value, ",") {
+				stageSet := dependency.StageSet{Stages: []dependency.Stage{}}
+				for _, term := range strings.Split(terms, "+") {
+					stageSet.Stages = append(stageSet.Stages, dependency.Stage{
+						Not:  strings.HasPrefix(term, "!"),
+						Name: strings.TrimPrefix(term, "!"),
+					})
+				}
+				e.Profiles = append(e.Profiles, stageSet)
+			}
+		default:
+			e.Options[key] = value
+		}
+	}
+	return nil
+}
+
+func (e PackageListEntry) MarshalControl() (string, error) {
+	fields := []string{e.Package, e.Type, e.Section, e.Priority}
+
+	if len(e.Architectures) != 0 {
+		arches := []string{}
+		for _, arch := range e.Architectures {
+			arches = append(arches, arch.String())
+		}
+		fields = append(fields, "arch="+strings.Join(arches, ","))
+	}
+
+	if len(e.Profiles) != 0 {
+		stageSets := []string{}
+		for _, stageSet := range e.Profiles {
+			terms := []string{}
+			for _, stage := range stageSet.Stages {
+				if stage.Not {
+					terms = append(terms, "!"+stage.Name)
+				} else {
+					terms = append(terms, stage.Name)
+				}
+			}
+			stageSets = append(stageSets, strings.Join(terms, "+"))
+		}
+		fields = append(fields, "profile="+strings.Join(stageSets, ","))
+	}
+
+	keys := []string{}
+	for key := range e.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, key+"="+e.Options[key])
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+// Check to see if this binary package is built on `arch`. Packages
+// without an "arch=" option, and "arch=all" packages (which can be
+// installed on every architecture) are always built.
+func (e PackageListEntry) BuildsOn(arch dependency.Arch) bool {
+	if len(e.Architectures) == 0 {
+		return true
+	}
+	for _, el := range e.Architectures {
+		if el.CPU == "all" || el.Is(&arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check to see if this binary package is built when building with the
+// given set of active build profiles.
+func (e PackageListEntry) BuildsWithProfiles(profiles []string) bool {
+	if len(e.Profiles) == 0 {
+		return true
+	}
+	for _, stageSet := range e.Profiles {
+		if stageSet.Matches(profiles) {
+			return true
+		}
+	}
+	return false
+}
+
+// }}}
+
+// vim: foldmethod=marker
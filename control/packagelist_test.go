@@ -0,0 +1,124 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+func TestPackageListEntry(t *testing.T) {
+	entry := control.PackageListEntry{}
+	isok(t, entry.UnmarshalControl(
+		"hello-doc deb doc optional arch=all,amd64 profile=!nodoc,stage1+cross essential=yes",
+	))
+	assert(t, entry.Package == "hello-doc")
+	assert(t, entry.Type == "deb")
+	assert(t, entry.Section == "doc")
+	assert(t, entry.Priority == "optional")
+	assert(t, len(entry.Architectures) == 2)
+	assert(t, len(entry.Profiles) == 2)
+	assert(t, len(entry.Profiles[1].Stages) == 2)
+	assert(t, entry.Profiles[0].Stages[0].Not)
+	assert(t, entry.Options["essential"] == "yes")
+
+	line, err := entry.MarshalControl()
+	isok(t, err)
+	assert(t, line == "hello-doc deb doc optional arch=all,amd64 profile=!nodoc,stage1+cross essential=yes")
+
+	assert(t, entry.BuildsWithProfiles([]string{}))
+	assert(t, entry.BuildsWithProfiles([]string{"stage1", "cross", "nodoc"}))
+	assert(t, !entry.BuildsWithProfiles([]string{"nodoc"}))
+
+	notok(t, entry.UnmarshalControl("hello deb"))
+	notok(t, entry.UnmarshalControl("hello deb devel optional arch"))
+}
+
+func TestPackageListEntryBuildsOn(t *testing.T) {
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	hurd, err := dependency.ParseArch("hurd-i386")
+	isok(t, err)
+
+	entry := control.PackageListEntry{}
+	isok(t, entry.UnmarshalControl("hello deb devel optional arch=linux-any"))
+	assert(t, entry.BuildsOn(*amd64))
+	assert(t, !entry.BuildsOn(*hurd))
+
+	isok(t, entry.UnmarshalControl("hello-doc deb doc optional arch=all"))
+	assert(t, entry.BuildsOn(*hurd))
+
+	isok(t, entry.UnmarshalControl("hello deb devel optional"))
+	assert(t, entry.BuildsOn(*hurd))
+}
+
+func TestOrderDSCForBuildPackageList(t *testing.T) {
+	foo, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: foo
+Binary: foo, libfoo-dev
+Version: 1.0-1
+Build-Depends: libbar-dev
+Package-List:
+ foo deb utils optional arch=any
+ libfoo-dev deb libdevel optional arch=amd64
+`)), "")
+	isok(t, err)
+	assert(t, len(foo.PackageList) == 2)
+	assert(t, foo.PackageList[1].Package == "libfoo-dev")
+
+	bar, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: bar
+Binary: libbar-dev
+Version: 1.0-1
+Build-Depends: libfoo-dev
+Package-List:
+ libbar-dev deb libdevel optional arch=any
+`)), "")
+	isok(t, err)
+
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	armhf, err := dependency.ParseArch("armhf")
+	isok(t, err)
+
+	binaries := foo.GetBinaries(*armhf)
+	assert(t, len(binaries) == 1 && binaries[0] == "foo")
+
+	/* libfoo-dev is only built on amd64, so there's only a cycle there */
+	_, err = control.OrderDSCForBuild([]control.DSC{*foo, *bar}, *amd64)
+	notok(t, err)
+
+	order, err := control.OrderDSCForBuild([]control.DSC{*foo, *bar}, *armhf)
+	isok(t, err)
+	assert(t, len(order) == 2)
+	assert(t, order[0].Source == "bar")
+	assert(t, order[1].Source == "foo")
+}
+
+// vim: foldmethod=marker
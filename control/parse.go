@@ -59,11 +59,21 @@ func (p *Paragraph) WriteTo(out io.Writer) error {
 	for _, key := range p.Order {
 		value := p.Values[key]
 
+		/* Parsed multi-line values carry a trailing newline, which would
+		 * otherwise be written out as an empty continuation line. */
+		value = strings.TrimRight(value, "\n")
 		value = strings.Replace(value, "\n", "\n ", -1)
 		value = strings.Replace(value, "\n \n", "\n .\n", -1)
 
+		/* Values which start on the next line (such as a list of files)
+		 * don't get a trailing space after the colon. */
+		format := "%s: %s\n"
+		if strings.HasPrefix(value, "\n") {
+			format = "%s:%s\n"
+		}
+
 		if _, err := out.Write(
-			[]byte(fmt.Sprintf("%s: %s\n", key, value)),
+			[]byte(fmt.Sprintf(format, key, value)),
 		); err != nil {
 			return err
 		}
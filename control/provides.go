@@ -0,0 +1,142 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// ProvidesIndex {{{
+
+// A virtual package provided by a real binary package, along with the
+// (optional) version it's provided at.
+type virtualProvider struct {
+	index   *BinaryIndex
+	provide dependency.Possibility
+}
+
+// A ProvidesIndex is a lookup table over a set of BinaryIndex entries, which
+// finds every package that may satisfy a dependency.Possibility, either
+// because it's the package named by the relation, or because it Provides
+// the (virtual) package named by the relation.
+//
+// Relations are matched following section 7.5 of Debian policy: an
+// unversioned relation is satisfied by any package which Provides the
+// name, but a versioned relation is only satisfied by a Provides which
+// carries an exact (=) version that satisfies the relation.
+//
+// The ProvidesIndex doesn't consider architecture qualifiers or the
+// Multi-Arch field, since whether those apply depends on the architecture
+// of the package declaring the relation. Entries are returned in the order
+// they were added.
+type ProvidesIndex struct {
+	packages map[string][]*BinaryIndex
+	virtual  map[string][]virtualProvider
+}
+
+// Create a new ProvidesIndex over all of the given BinaryIndex entries.
+func NewProvidesIndex(indices []BinaryIndex) *ProvidesIndex {
+	ret := ProvidesIndex{
+		packages: map[string][]*BinaryIndex{},
+		virtual:  map[string][]virtualProvider{},
+	}
+	for i := range indices {
+		ret.Add(&indices[i])
+	}
+	return &ret
+}
+
+// Add a BinaryIndex entry to the ProvidesIndex.
+func (p *ProvidesIndex) Add(index *BinaryIndex) {
+	p.packages[index.Package] = append(p.packages[index.Package], index)
+	provides := index.GetProvides()
+	for _, provide := range provides.GetAllPossibilities() {
+		p.virtual[provide.Name] = append(p.virtual[provide.Name], virtualProvider{
+			index:   index,
+			provide: provide,
+		})
+	}
+}
+
+// Return all of the real packages with the given name.
+func (p *ProvidesIndex) Packages(name string) []*BinaryIndex {
+	return p.packages[name]
+}
+
+// Return all of the packages which Provide the given (virtual) package
+// name, at any version.
+func (p *ProvidesIndex) Providers(name string) []*BinaryIndex {
+	ret := []*BinaryIndex{}
+	for _, provider := range p.virtual[name] {
+		ret = append(ret, provider.index)
+	}
+	return ret
+}
+
+// Return every package which satisfies the Possibility, ignoring any
+// architecture qualifier. Real packages are returned before the packages
+// which Provide the name.
+func (p *ProvidesIndex) Lookup(possi dependency.Possibility) []*BinaryIndex {
+	ret := []*BinaryIndex{}
+	seen := map[*BinaryIndex]bool{}
+
+	for _, index := range p.packages[possi.Name] {
+		if possi.Version == nil || possi.Version.SatisfiedBy(index.Version) {
+			seen[index] = true
+			ret = append(ret, index)
+		}
+	}
+	for _, provider := range p.virtual[possi.Name] {
+		if seen[provider.index] || !ProvideSatisfies(provider.provide, possi) {
+			continue
+		}
+		seen[provider.index] = true
+		ret = append(ret, provider.index)
+	}
+
+	return ret
+}
+
+// Check to see if the Provides entry `provide` satisfies the relation
+// `possi`, ignoring any architecture qualifier. Unversioned Provides never
+// satisfy a versioned relation, and versioned Provides must be exact
+// (policy 7.5).
+func ProvideSatisfies(provide, possi dependency.Possibility) bool {
+	if provide.Name != possi.Name {
+		return false
+	}
+	if possi.Version == nil {
+		return true
+	}
+	if provide.Version == nil || provide.Version.Operator != "=" {
+		return false
+	}
+	provided, err := version.Parse(provide.Version.Number)
+	if err != nil {
+		return false
+	}
+	return possi.Version.SatisfiedBy(provided)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,66 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+func lookupNames(t *testing.T, index *control.ProvidesIndex, relation string) string {
+	dep, err := dependency.Parse(relation)
+	isok(t, err)
+	names := []string{}
+	for _, entry := range index.Lookup(dep.Relations[0].Possibilities[0]) {
+		names = append(names, entry.Package+":"+entry.Architecture.String())
+	}
+	return strings.Join(names, " ")
+}
+
+func TestProvidesIndex(t *testing.T) {
+	indices, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(resolverPackages)))
+	isok(t, err)
+	index := control.NewProvidesIndex(indices)
+
+	provides := indices[4].GetProvides()
+	assert(t, len(provides.Relations) == 1)
+	assert(t, provides.Relations[0].Possibilities[0].Name == "mail-transport-agent")
+
+	assert(t, lookupNames(t, index, "libc6 (>= 2.30)") == "libc6:amd64 libc6:i386")
+	assert(t, lookupNames(t, index, "libc6 (>= 3.0)") == "")
+	assert(t, lookupNames(t, index, "mail-transport-agent") == "exim4:amd64 postfix:amd64")
+	/* Unversioned Provides never satisfy versioned relations */
+	assert(t, lookupNames(t, index, "mail-transport-agent (>= 1.0)") == "")
+	assert(t, lookupNames(t, index, "python3-any (>= 3.9)") == "python3:amd64")
+	assert(t, lookupNames(t, index, "python3-any (>> 3.12)") == "")
+	assert(t, len(index.Providers("python3-any")) == 1)
+	assert(t, len(index.Packages("python3-any")) == 0)
+}
+
+// vim: foldmethod=marker
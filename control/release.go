@@ -0,0 +1,352 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/hashio"
+)
+
+// The Release struct represents the top level Release (or InRelease) file
+// of an APT archive, found at dists/<suite>/ on Debian (and Debian derived)
+// mirrors, as well as the cached version in /var/lib/apt/lists/.
+//
+// The Release file describes the suite, and lists every index file (such
+// as Packages, Sources or Contents) along with its size and checksum, so
+// that index files fetched from a mirror can be checked against a single
+// signed document.
+type Release struct {
+	Paragraph
+
+	Origin        string
+	Label         string
+	Suite         string
+	Version       string
+	Codename      string
+	Changelogs    string
+	Date          string
+	ValidUntil    string            `control:"Valid-Until"`
+	AcquireByHash bool              `control:"Acquire-By-Hash"`
+	Architectures []dependency.Arch `control:"Architectures"`
+	Components    []string          `control:"Components"`
+	Description   string
+
+	MD5Sum []MD5FileHash    `control:"MD5Sum" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA1   []SHA1FileHash   `control:"SHA1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA256 []SHA256FileHash `control:"SHA256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA512 []SHA512FileHash `control:"SHA512" delim:"\n" strip:"\n\r\t " multiline:"true"`
+}
+
+// Given a path on the filesystem, Parse the file off the disk and return
+// a pointer to a brand new Release struct, unless error is set to a value
+// other than nil.
+//
+// If the file is an InRelease file, and `keyring` is not nil, the OpenPGP
+// signature will be checked against the `keyring`.
+func ParseReleaseFile(path string, keyring *openpgp.EntityList) (*Release, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseRelease(f, keyring)
+}
+
+// Given an io.Reader, consume the Reader, and return a Release object
+// for use. Clearsigned (InRelease) input is checked against the `keyring`
+// unless `keyring` is nil, in which case the signature is ignored.
+func ParseRelease(reader io.Reader, keyring *openpgp.EntityList) (*Release, error) {
+	decoder, err := NewDecoder(reader, keyring)
+	if err != nil {
+		return nil, err
+	}
+	ret := Release{}
+	if err := decoder.Decode(&ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// parseReleaseTime parses the Date and Valid-Until fields, which are
+// written in RFC 2822 format, though the timezone is written as "UTC"
+// by most archive software, rather than a numeric offset.
+func parseReleaseTime(when string) (time.Time, error) {
+	for _, layout := range []string{time.RFC1123, time.RFC1123Z} {
+		if ret, err := time.Parse(layout, when); err == nil {
+			return ret, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Unknown Release date format: '%s'", when)
+}
+
+// Parse the Date field of the Release into a time.Time.
+func (r *Release) GetDate() (time.Time, error) {
+	return parseReleaseTime(r.Date)
+}
+
+// Parse the Valid-Until field of the Release into a time.Time. If the
+// Release has no Valid-Until field, a zero time.Time is returned.
+func (r *Release) GetValidUntil() (time.Time, error) {
+	if r.ValidUntil == "" {
+		return time.Time{}, nil
+	}
+	return parseReleaseTime(r.ValidUntil)
+}
+
+// Check to see if the Release has expired as of the time `now`, according
+// to its Valid-Until field. Releases without Valid-Until never expire.
+func (r *Release) Expired(now time.Time) (bool, error) {
+	validUntil, err := r.GetValidUntil()
+	if err != nil {
+		return false, err
+	}
+	if validUntil.IsZero() {
+		return false, nil
+	}
+	return now.After(validUntil), nil
+}
+
+// Indices returns a map of every index file listed in the Release, keyed
+// by path relative to the Release file, using the strongest checksum
+// available for each file (SHA512, falling back to SHA256).
+//
+// Files only listed with MD5Sum or SHA1 checksums are not returned, since
+// those checksums can not be trusted to authenticate a file.
+func (r *Release) Indices() map[string]FileHash {
+	ret := map[string]FileHash{}
+	for _, hash := range r.SHA256 {
+		ret[hash.Filename] = hash.FileHash
+	}
+	for _, hash := range r.SHA512 {
+		ret[hash.Filename] = hash.FileHash
+	}
+	return ret
+}
+
+// VerifyIndex checks the index file at `path` (relative to the Release
+// file, such as "main/binary-amd64/Packages.xz") by reading all of `reader`,
+// and comparing both the size and the checksum against the values listed
+// in the Release.
+func (r *Release) VerifyIndex(path string, reader io.Reader) error {
+	path = strings.TrimPrefix(filepath.ToSlash(path), "./")
+	fileHash, ok := r.Indices()[path]
+	if !ok {
+		return fmt.Errorf("Index '%s' is not listed in the Release", path)
+	}
+
+	verifier, err := fileHash.Verifier()
+	if err != nil {
+		return err
+	}
+
+	size, err := io.Copy(verifier, reader)
+	if err != nil {
+		return err
+	}
+	if size != fileHash.Size {
+		return fmt.Errorf(
+			"Index '%s' has the wrong size: got %d, want %d",
+			path, size, fileHash.Size,
+		)
+	}
+	return verifier.Close()
+}
+
+// VerifyIndexFile checks the index file at `path` (relative to the Release
+// file) against the Release, reading the file from beneath `root`, which
+// is usually the dists/<suite> directory the Release was found in.
+func (r *Release) VerifyIndexFile(root, path string) error {
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(path)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.VerifyIndex(path, f)
+}
+
+// Release generation {{{
+
+// Names of the files that make up a signed Release, which must never be
+// listed inside the Release itself.
+var releaseFiles = map[string]bool{
+	"Release":     true,
+	"Release.gpg": true,
+	"InRelease":   true,
+}
+
+// GenerateRelease walks the dists/<suite> directory at `root`, and returns
+// a copy of `template` with the MD5Sum, SHA1, SHA256 and SHA512 lists filled
+// in for every file found beneath `root`.
+//
+// The top level Release, Release.gpg and InRelease files, as well as
+// anything inside a by-hash directory, are skipped. If the Date field of
+// `template` is empty, it will be set to the current time.
+func GenerateRelease(root string, template Release) (*Release, error) {
+	ret := template
+	ret.MD5Sum = []MD5FileHash{}
+	ret.SHA1 = []SHA1FileHash{}
+	ret.SHA256 = []SHA256FileHash{}
+	ret.SHA512 = []SHA512FileHash{}
+
+	if ret.Date == "" {
+		ret.Date = time.Now().UTC().Format(time.RFC1123)
+	}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == "by-hash" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if releaseFiles[relPath] {
+			return nil
+		}
+
+		hashers, err := hashReleaseIndex(path)
+		if err != nil {
+			return err
+		}
+		ret.MD5Sum = append(ret.MD5Sum, MD5FileHash{FileHashFromHasher(relPath, *hashers[0])})
+		ret.SHA1 = append(ret.SHA1, SHA1FileHash{FileHashFromHasher(relPath, *hashers[1])})
+		ret.SHA256 = append(ret.SHA256, SHA256FileHash{FileHashFromHasher(relPath, *hashers[2])})
+		ret.SHA512 = append(ret.SHA512, SHA512FileHash{FileHashFromHasher(relPath, *hashers[3])})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// hashReleaseIndex reads the file at `path`, and returns the md5, sha1,
+// sha256 and sha512 Hashers (in that order) of its contents.
+func hashReleaseIndex(path string) ([]*hashio.Hasher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	writer, hashers, err := hashio.NewHasherWriters(
+		[]string{"md5", "sha1", "sha256", "sha512"},
+		io.Discard,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(writer, f); err != nil {
+		return nil, err
+	}
+	return hashers, nil
+}
+
+// WriteReleaseFiles serializes the Release into the dists/<suite> directory
+// at `root`. An unsigned Release file is always written. If `signer` is not
+// nil, a clearsigned InRelease and an armored detached Release.gpg signature
+// are written as well. The `signer` must have a decrypted private key.
+func (r *Release) WriteReleaseFiles(root string, signer *openpgp.Entity) error {
+	releaseBytes := bytes.Buffer{}
+	if err := Marshal(&releaseBytes, r); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(
+		filepath.Join(root, "Release"), releaseBytes.Bytes(), 0644,
+	); err != nil {
+		return err
+	}
+
+	if signer == nil {
+		return nil
+	}
+
+	inRelease := bytes.Buffer{}
+	if err := Clearsign(&inRelease, releaseBytes.Bytes(), signer); err != nil {
+		return err
+	}
+	if err := os.WriteFile(
+		filepath.Join(root, "InRelease"), inRelease.Bytes(), 0644,
+	); err != nil {
+		return err
+	}
+
+	releaseGpg := bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(
+		&releaseGpg, signer, bytes.NewReader(releaseBytes.Bytes()), nil,
+	); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, "Release.gpg"), releaseGpg.Bytes(), 0644)
+}
+
+// Clearsign writes an OpenPGP clearsigned copy of `data` (such as a
+// serialized Release or .changes file) to `writer`, signed by `signer`,
+// suitable for use as an InRelease file or a signed upload.
+func Clearsign(writer io.Writer, data []byte, signer *openpgp.Entity) error {
+	if signer.PrivateKey == nil {
+		return fmt.Errorf("Signing entity has no private key")
+	}
+	plaintext, err := clearsign.Encode(writer, signer.PrivateKey, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := plaintext.Write(data); err != nil {
+		plaintext.Close()
+		return err
+	}
+	return plaintext.Close()
+}
+
+// }}}
+
+// vim: foldmethod=marker
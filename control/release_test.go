@@ -0,0 +1,171 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// Test Release {{{
+const testRelease = `Origin: Debian
+Label: Debian
+Suite: unstable
+Codename: sid
+Changelogs: https://metadata.ftp-master.debian.org/changelogs/@CHANGEPATH@_changelog
+Date: Sat, 14 Aug 2021 07:51:51 UTC
+Valid-Until: Sat, 21 Aug 2021 07:51:51 UTC
+Acquire-By-Hash: yes
+Architectures: all amd64 arm64
+Components: main contrib non-free
+Description: Debian x.y Unstable - Not Released
+MD5Sum:
+ 82c88dbffc96d5a3d0e62207e8cdb288       13 main/binary-amd64/Packages
+ d41d8cd98f00b204e9800998ecf8427e        0 main/binary-arm64/Packages
+SHA256:
+ 10ba9a762e3ef316246436a5f52aebf2b244fb7640aef5739b250edc51e1f9cb       13 main/binary-amd64/Packages
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855        0 main/binary-arm64/Packages
+`
+
+// }}}
+
+func TestReleaseParse(t *testing.T) {
+	release, err := control.ParseRelease(strings.NewReader(testRelease), nil)
+	isok(t, err)
+
+	assert(t, release.Origin == "Debian")
+	assert(t, release.Suite == "unstable")
+	assert(t, release.Codename == "sid")
+	assert(t, release.AcquireByHash)
+	assert(t, len(release.Architectures) == 3)
+	assert(t, release.Architectures[1].CPU == "amd64")
+	assert(t, len(release.Components) == 3)
+	assert(t, release.Components[2] == "non-free")
+
+	assert(t, len(release.MD5Sum) == 2)
+	assert(t, len(release.SHA256) == 2)
+	assert(t, release.SHA256[0].Filename == "main/binary-amd64/Packages")
+	assert(t, release.SHA256[0].Size == 13)
+	assert(t, release.SHA256[0].ByHash == "SHA256")
+
+	date, err := release.GetDate()
+	isok(t, err)
+	assert(t, date.Equal(time.Date(2021, 8, 14, 7, 51, 51, 0, time.UTC)))
+
+	expired, err := release.Expired(date)
+	isok(t, err)
+	assert(t, !expired)
+	expired, err = release.Expired(date.AddDate(0, 1, 0))
+	isok(t, err)
+	assert(t, expired)
+}
+
+func TestReleaseVerifyIndex(t *testing.T) {
+	release, err := control.ParseRelease(strings.NewReader(testRelease), nil)
+	isok(t, err)
+
+	indices := release.Indices()
+	assert(t, len(indices) == 2)
+
+	isok(t, release.VerifyIndex(
+		"main/binary-amd64/Packages",
+		strings.NewReader("Package: foo\n"),
+	))
+	isok(t, release.VerifyIndex(
+		"main/binary-arm64/Packages",
+		strings.NewReader(""),
+	))
+
+	/* Wrong contents, but the same size */
+	notok(t, release.VerifyIndex(
+		"main/binary-amd64/Packages",
+		strings.NewReader("Package: bar\n"),
+	))
+	/* Wrong size */
+	notok(t, release.VerifyIndex(
+		"main/binary-amd64/Packages",
+		strings.NewReader("Package: foobar\n"),
+	))
+	/* Not listed */
+	notok(t, release.VerifyIndex(
+		"main/binary-i386/Packages",
+		strings.NewReader(""),
+	))
+}
+
+func TestReleaseGenerate(t *testing.T) {
+	root := t.TempDir()
+	isok(t, os.MkdirAll(filepath.Join(root, "main", "binary-amd64"), 0755))
+	isok(t, os.MkdirAll(filepath.Join(root, "main", "binary-amd64", "by-hash", "SHA256"), 0755))
+	isok(t, os.WriteFile(
+		filepath.Join(root, "main", "binary-amd64", "Packages"),
+		[]byte("Package: foo\n"), 0644,
+	))
+	isok(t, os.WriteFile(
+		filepath.Join(root, "main", "binary-amd64", "by-hash", "SHA256", "deadbeef"),
+		[]byte("Package: foo\n"), 0644,
+	))
+	isok(t, os.WriteFile(filepath.Join(root, "Release"), []byte("stale\n"), 0644))
+
+	release, err := control.GenerateRelease(root, control.Release{
+		Suite:      "unstable",
+		Codename:   "sid",
+		Components: []string{"main"},
+	})
+	isok(t, err)
+	assert(t, release.Date != "")
+	assert(t, len(release.MD5Sum) == 1)
+	assert(t, len(release.SHA512) == 1)
+	assert(t, release.SHA256[0].Filename == "main/binary-amd64/Packages")
+	assert(t, release.SHA256[0].Hash == "10ba9a762e3ef316246436a5f52aebf2b244fb7640aef5739b250edc51e1f9cb")
+	assert(t, release.SHA256[0].Size == 13)
+
+	signer, err := openpgp.NewEntity("Test Archive", "", "archive@example.com", nil)
+	isok(t, err)
+	isok(t, release.WriteReleaseFiles(root, signer))
+
+	keyring := openpgp.EntityList{signer}
+	inRelease, err := control.ParseReleaseFile(filepath.Join(root, "InRelease"), &keyring)
+	isok(t, err)
+	assert(t, inRelease.Codename == "sid")
+	isok(t, inRelease.VerifyIndexFile(root, "main/binary-amd64/Packages"))
+
+	releaseFile, err := os.Open(filepath.Join(root, "Release"))
+	isok(t, err)
+	defer releaseFile.Close()
+	releaseGpg, err := os.Open(filepath.Join(root, "Release.gpg"))
+	isok(t, err)
+	defer releaseGpg.Close()
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, releaseFile, releaseGpg)
+	isok(t, err)
+}
+
+// vim: foldmethod=marker
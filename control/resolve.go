@@ -0,0 +1,489 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Default upper bound on the number of candidates the Resolver will try
+// before giving up, to keep pathological package sets from running forever.
+const maxResolverSteps = 100000
+
+// resolverPackage {{{
+
+// A binary package that may be installed by the Resolver, with all of the
+// relations we care about parsed up front.
+type resolverPackage struct {
+	index *BinaryIndex
+	arch  dependency.Arch
+
+	depends   []dependency.Relation
+	conflicts []dependency.Possibility
+	provides  []dependency.Possibility
+}
+
+func (p *resolverPackage) String() string {
+	return fmt.Sprintf("%s:%s (%s)", p.index.Package, p.arch, p.index.Version)
+}
+
+func (p *resolverPackage) isArchAll() bool {
+	return p.arch == dependency.All
+}
+
+// Return the arch that the relations of this package are evaluated
+// against. Architecture: all packages are treated as native.
+func (p *resolverPackage) relationArch(native dependency.Arch) dependency.Arch {
+	if p.isArchAll() {
+		return native
+	}
+	return p.arch
+}
+
+// }}}
+
+// Resolver {{{
+
+// A Resolver answers the question "can this set of relations be installed
+// from these Packages files?", in the same spirit as apt, for one or more
+// architectures at once.
+//
+// Depends and Pre-Depends (including alternatives) must be satisfied,
+// Conflicts and Breaks must not be violated, Provides (including versioned
+// Provides) satisfy relations on virtual packages, and the Multi-Arch field
+// is honoured when deciding whether a package of one architecture can
+// satisfy the relation of a package of another.
+//
+// The Resolver prefers the first alternative of a relation, and the
+// highest version of a package, backtracking when a choice leads to a
+// conflict further down the line.
+type Resolver struct {
+	// The native architecture. Architecture: all packages are treated as
+	// being of this architecture when their own relations are evaluated.
+	Arch dependency.Arch
+
+	// The number of candidate packages to try before giving up. Defaults
+	// to 100000.
+	MaxSteps int
+
+	packages map[string][]*resolverPackage
+	provides *ProvidesIndex
+	byIndex  map[*BinaryIndex]*resolverPackage
+}
+
+// Create a new Resolver over all of the given BinaryIndex entries, which
+// may be of any number of architectures (for instance, the Packages files
+// for amd64 and i386, as well as binary-all).
+func NewResolver(arch dependency.Arch, indices []BinaryIndex) *Resolver {
+	ret := Resolver{
+		Arch:     arch,
+		packages: map[string][]*resolverPackage{},
+		provides: NewProvidesIndex(nil),
+		byIndex:  map[*BinaryIndex]*resolverPackage{},
+	}
+
+	for i := range indices {
+		index := &indices[i]
+		pkg := resolverPackage{
+			index: index,
+			arch:  index.Architecture,
+		}
+		relationArch := pkg.relationArch(arch)
+
+		for _, field := range []string{"Pre-Depends", "Depends"} {
+			dep := index.getOptionalDependencyField(field)
+			pkg.depends = append(pkg.depends, dep.GetRelations(relationArch)...)
+		}
+		for _, field := range []string{"Conflicts", "Breaks"} {
+			dep := index.getOptionalDependencyField(field)
+			pkg.conflicts = append(pkg.conflicts, dep.GetAllPossibilities()...)
+		}
+		provides := index.GetProvides()
+		pkg.provides = provides.GetAllPossibilities()
+
+		ret.packages[index.Package] = append(ret.packages[index.Package], &pkg)
+		ret.provides.Add(index)
+		ret.byIndex[index] = &pkg
+	}
+
+	/* Highest versions first, native arch before foreign ones. */
+	for _, pkgs := range ret.packages {
+		sort.SliceStable(pkgs, func(i, j int) bool {
+			if q := version.Compare(pkgs[i].index.Version, pkgs[j].index.Version); q != 0 {
+				return q > 0
+			}
+			return pkgs[i].arch == arch && pkgs[j].arch != arch
+		})
+	}
+
+	return &ret
+}
+
+// Resolve the given Dependency (as if it were the Depends of a package of
+// the Resolver's native Arch), and return the set of BinaryIndex entries
+// that would need to be installed to satisfy it, sorted by name.
+//
+// If the Dependency can not be satisfied, an *UnsatisfiableError is
+// returned, explaining the chain of relations that could not be met. If
+// the Resolver gives up after trying MaxSteps candidates, an error saying
+// so is returned instead, since the Dependency may yet be satisfiable.
+func (r *Resolver) Resolve(dep dependency.Dependency) ([]BinaryIndex, error) {
+	return r.resolve(dep.GetRelations(r.Arch), nil, r.Arch)
+}
+
+// Resolve the `relations` as if declared by a package of architecture
+// `arch`, without installing anything matched by `conflicts`.
+func (r *Resolver) resolve(
+	relations []dependency.Relation,
+	conflicts []dependency.Possibility,
+	arch dependency.Arch,
+) ([]BinaryIndex, error) {
+	s := solver{
+		resolver:  r,
+		installed: map[*resolverPackage]bool{},
+		conflicts: conflicts,
+		maxSteps:  r.MaxSteps,
+	}
+	if s.maxSteps <= 0 {
+		s.maxSteps = maxResolverSteps
+	}
+
+	goals := []goal{}
+	for _, relation := range relations {
+		goals = append(goals, goal{relation: relation, arch: arch})
+	}
+
+	if !s.solve(goals) {
+		/* Any failure recorded so far was only one branch of the search */
+		if s.steps > s.maxSteps {
+			return nil, fmt.Errorf(
+				"Gave up resolving after trying %d candidates", s.maxSteps,
+			)
+		}
+		return nil, s.failure
+	}
+
+	ret := []BinaryIndex{}
+	for pkg := range s.installed {
+		ret = append(ret, *pkg.index)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Package != ret[j].Package {
+			return ret[i].Package < ret[j].Package
+		}
+		return ret[i].Architecture.String() < ret[j].Architecture.String()
+	})
+	return ret, nil
+}
+
+// }}}
+
+// Relation matching {{{
+
+// Check to see if the package `pkg` satisfies the Possibility `possi`,
+// either directly, or through one of its Provides. `arch` is the
+// architecture of the package that declared the relation.
+func (r *Resolver) satisfies(pkg *resolverPackage, possi dependency.Possibility, arch dependency.Arch) bool {
+	if !r.archSatisfies(pkg, possi, arch) {
+		return false
+	}
+
+	if pkg.index.Package == possi.Name {
+		if possi.Version == nil || possi.Version.SatisfiedBy(pkg.index.Version) {
+			return true
+		}
+	}
+
+	for _, provide := range pkg.provides {
+		if ProvideSatisfies(provide, possi) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check to see if `pkg` may satisfy the relation `possi` of a package of
+// architecture `arch`, given the Multi-Arch field of `pkg`, and any
+// architecture qualifier on the relation.
+func (r *Resolver) archSatisfies(pkg *resolverPackage, possi dependency.Possibility, arch dependency.Arch) bool {
+	sameArch := pkg.isArchAll() || pkg.arch == arch
+
+	if possi.Arch == nil {
+		return sameArch || pkg.index.MultiArch == "foreign"
+	}
+
+	switch possi.Arch.String() {
+	case "any":
+		return sameArch || pkg.index.MultiArch == "allowed"
+	case "native":
+		return pkg.isArchAll() || pkg.arch == r.Arch
+	}
+	return pkg.isArchAll() || pkg.arch == *possi.Arch
+}
+
+// Check to see if the Conflicts or Breaks relation `possi` of some package
+// applies to `pkg`. Unqualified conflicts apply to packages of every
+// architecture.
+func (r *Resolver) conflictsWith(pkg *resolverPackage, possi dependency.Possibility) bool {
+	if possi.Arch != nil {
+		if !(pkg.isArchAll() || possi.Arch.String() == "any" || pkg.arch == *possi.Arch) {
+			return false
+		}
+	}
+
+	if pkg.index.Package == possi.Name {
+		return possi.Version == nil || possi.Version.SatisfiedBy(pkg.index.Version)
+	}
+
+	for _, provide := range pkg.provides {
+		if ProvideSatisfies(provide, possi) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return every package that could satisfy the Relation, in order of
+// preference.
+func (r *Resolver) candidates(relation dependency.Relation, arch dependency.Arch) []*resolverPackage {
+	ret := []*resolverPackage{}
+	seen := map[*resolverPackage]bool{}
+
+	for _, possi := range relation.Possibilities {
+		/* Real packages first (already in order of preference), then
+		 * anything that Provides the name. */
+		pkgs := append([]*resolverPackage{}, r.packages[possi.Name]...)
+		for _, index := range r.provides.Providers(possi.Name) {
+			pkgs = append(pkgs, r.byIndex[index])
+		}
+
+		for _, pkg := range pkgs {
+			if seen[pkg] || !r.satisfies(pkg, possi, arch) {
+				continue
+			}
+			seen[pkg] = true
+			ret = append(ret, pkg)
+		}
+	}
+
+	return ret
+}
+
+// }}}
+
+// solver {{{
+
+// A link in the chain of relations that lead the solver to a goal, used
+// to explain why a relation could not be satisfied.
+type chainLink struct {
+	pkg      *resolverPackage
+	relation dependency.Relation
+	parent   *chainLink
+}
+
+// A Relation which must be satisfied, along with the architecture of the
+// package which declared it, and the chain of relations that lead here.
+type goal struct {
+	relation dependency.Relation
+	arch     dependency.Arch
+	chain    *chainLink
+}
+
+type solver struct {
+	resolver  *Resolver
+	installed map[*resolverPackage]bool
+	conflicts []dependency.Possibility
+	steps     int
+	maxSteps  int
+
+	failure *UnsatisfiableError
+}
+
+func (s *solver) solve(goals []goal) bool {
+	if len(goals) == 0 {
+		return true
+	}
+	current, rest := goals[0], goals[1:]
+
+	for pkg := range s.installed {
+		for _, possi := range current.relation.Possibilities {
+			if s.resolver.satisfies(pkg, possi, current.arch) {
+				return s.solve(rest)
+			}
+		}
+	}
+
+	candidates := s.resolver.candidates(current.relation, current.arch)
+	if len(candidates) == 0 {
+		s.fail(current, fmt.Sprintf(
+			"no package satisfies '%s'%s",
+			current.relation, s.resolver.available(current.relation),
+		))
+		return false
+	}
+
+	for _, pkg := range candidates {
+		s.steps++
+		if s.steps > s.maxSteps {
+			return false
+		}
+
+		if reason := s.conflict(pkg); reason != "" {
+			s.fail(current, reason)
+			continue
+		}
+
+		s.installed[pkg] = true
+		link := &chainLink{pkg: pkg, relation: current.relation, parent: current.chain}
+		next := make([]goal, 0, len(pkg.depends)+len(rest))
+		for _, relation := range pkg.depends {
+			next = append(next, goal{
+				relation: relation,
+				arch:     pkg.relationArch(s.resolver.Arch),
+				chain:    link,
+			})
+		}
+		next = append(next, rest...)
+
+		if s.solve(next) {
+			return true
+		}
+		delete(s.installed, pkg)
+
+		if s.steps > s.maxSteps {
+			return false
+		}
+	}
+
+	return false
+}
+
+// Check to see if `pkg` can be installed alongside everything that's
+// already been installed, and if not, return why.
+func (s *solver) conflict(pkg *resolverPackage) string {
+	for _, possi := range s.conflicts {
+		if s.resolver.conflictsWith(pkg, possi) {
+			return fmt.Sprintf("%s is forbidden by '%s'", pkg, possi)
+		}
+	}
+
+	for other := range s.installed {
+		if other.index.Package == pkg.index.Package {
+			if other.arch == pkg.arch {
+				return fmt.Sprintf("%s can not be installed alongside %s", pkg, other)
+			}
+			if other.index.MultiArch != "same" || pkg.index.MultiArch != "same" ||
+				version.Compare(other.index.Version, pkg.index.Version) != 0 {
+				return fmt.Sprintf("%s is not co-installable with %s", pkg, other)
+			}
+			continue
+		}
+
+		for _, possi := range pkg.conflicts {
+			if s.resolver.conflictsWith(other, possi) {
+				return fmt.Sprintf("%s conflicts with %s ('%s')", pkg, other, possi)
+			}
+		}
+		for _, possi := range other.conflicts {
+			if s.resolver.conflictsWith(pkg, possi) {
+				return fmt.Sprintf("%s conflicts with %s ('%s')", other, pkg, possi)
+			}
+		}
+	}
+	return ""
+}
+
+// Record why a goal could not be satisfied. Since the solver backtracks,
+// many goals will fail along the way; the failure with the longest chain
+// of relations is kept, since it's usually the most useful to explain.
+func (s *solver) fail(current goal, reason string) {
+	links := []*chainLink{}
+	for link := current.chain; link != nil; link = link.parent {
+		links = append([]*chainLink{link}, links...)
+	}
+
+	top := current.relation
+	if len(links) > 0 {
+		top = links[0].relation
+	}
+	chain := []string{fmt.Sprintf("'%s' is required", top)}
+	for i, link := range links {
+		relation := current.relation
+		if i+1 < len(links) {
+			relation = links[i+1].relation
+		}
+		chain = append(chain, fmt.Sprintf("%s depends on '%s'", link.pkg, relation))
+	}
+
+	if s.failure != nil && len(chain) <= len(s.failure.Chain) {
+		return
+	}
+	s.failure = &UnsatisfiableError{Chain: chain, Reason: reason}
+}
+
+// Return a human readable list of the versions of the packages named by
+// the Relation that are known to the Resolver, if any.
+func (r *Resolver) available(relation dependency.Relation) string {
+	versions := []string{}
+	for _, possi := range relation.Possibilities {
+		for _, pkg := range r.packages[possi.Name] {
+			versions = append(versions, pkg.String())
+		}
+	}
+	if len(versions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (available: %s)", strings.Join(versions, ", "))
+}
+
+// }}}
+
+// UnsatisfiableError {{{
+
+// An UnsatisfiableError is returned by the Resolver when a set of relations
+// can not be satisfied. The Chain explains (from the top level relation
+// down) how the Resolver got to the relation it could not satisfy, and the
+// Reason explains why that relation failed.
+type UnsatisfiableError struct {
+	Chain  []string
+	Reason string
+}
+
+func (e *UnsatisfiableError) Error() string {
+	if len(e.Chain) == 0 {
+		return fmt.Sprintf("Unsatisfiable: %s", e.Reason)
+	}
+	return fmt.Sprintf(
+		"Unsatisfiable: %s: %s",
+		strings.Join(e.Chain, " -> "),
+		e.Reason,
+	)
+}
+
+// }}}
+
+// vim: foldmethod=marker
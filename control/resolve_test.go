@@ -0,0 +1,221 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+// Test Packages {{{
+const resolverPackages = `Package: hello
+Version: 2.10-2
+Architecture: amd64
+Depends: libc6 (>= 2.34)
+
+Package: libc6
+Version: 2.36-9
+Architecture: amd64
+Multi-Arch: same
+Breaks: hello (<< 2.0)
+
+Package: libc6
+Version: 2.36-9
+Architecture: i386
+Multi-Arch: same
+
+Package: mail-reader
+Version: 1.0-1
+Architecture: amd64
+Depends: mail-transport-agent
+
+Package: exim4
+Version: 4.96-15
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: postfix
+Version: 3.7.6-1
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent, exim4
+
+Package: picky
+Version: 1.0-1
+Architecture: amd64
+Depends: exim4 | postfix, mta-helper
+
+Package: mta-helper
+Version: 1.0-1
+Architecture: all
+Conflicts: exim4
+
+Package: python3
+Version: 3.11.2-1
+Architecture: amd64
+Multi-Arch: allowed
+Provides: python3-any (= 3.11.2-1)
+
+Package: python3-foo
+Version: 1.0-1
+Architecture: i386
+Depends: python3:any, python3-any:any (>= 3.9)
+
+Package: make
+Version: 4.3-4.1
+Architecture: amd64
+Multi-Arch: foreign
+
+Package: foreign-tool
+Version: 1.0-1
+Architecture: i386
+Depends: make, libc6
+
+Package: broken
+Version: 1.0-1
+Architecture: amd64
+Depends: hello, libfoo (>= 2.0)
+
+Package: libfoo
+Version: 1.0-1
+Architecture: amd64
+`
+
+// }}}
+
+func newTestResolver(t *testing.T) *control.Resolver {
+	indices, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(resolverPackages)))
+	isok(t, err)
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	return control.NewResolver(*arch, indices)
+}
+
+func resolvedNames(indices []control.BinaryIndex) []string {
+	ret := []string{}
+	for _, index := range indices {
+		ret = append(ret, index.Package+":"+index.Architecture.String())
+	}
+	return ret
+}
+
+func TestResolveSimple(t *testing.T) {
+	resolver := newTestResolver(t)
+
+	dep, err := dependency.Parse("hello")
+	isok(t, err)
+	installed, err := resolver.Resolve(*dep)
+	isok(t, err)
+	assert(t, strings.Join(resolvedNames(installed), " ") == "hello:amd64 libc6:amd64")
+}
+
+func TestResolveVirtual(t *testing.T) {
+	resolver := newTestResolver(t)
+
+	dep, err := dependency.Parse("mail-reader")
+	isok(t, err)
+	installed, err := resolver.Resolve(*dep)
+	isok(t, err)
+	assert(t, strings.Join(resolvedNames(installed), " ") == "exim4:amd64 mail-reader:amd64")
+
+	/* exim4 conflicts with mta-helper, so we need to backtrack to postfix */
+	dep, err = dependency.Parse("picky")
+	isok(t, err)
+	installed, err = resolver.Resolve(*dep)
+	isok(t, err)
+	assert(t, strings.Join(resolvedNames(installed), " ") == "mta-helper:all picky:amd64 postfix:amd64")
+
+	/* Two MTAs can't be installed at once */
+	dep, err = dependency.Parse("exim4, postfix")
+	isok(t, err)
+	_, err = resolver.Resolve(*dep)
+	notok(t, err)
+}
+
+func TestResolveMultiArch(t *testing.T) {
+	resolver := newTestResolver(t)
+
+	/* python3:any is satisfied by the Multi-Arch: allowed amd64 python3,
+	 * and python3-any by its versioned Provides. */
+	dep, err := dependency.Parse("python3-foo:i386")
+	isok(t, err)
+	installed, err := resolver.Resolve(*dep)
+	isok(t, err)
+	assert(t, strings.Join(resolvedNames(installed), " ") == "python3:amd64 python3-foo:i386")
+
+	/* make is Multi-Arch: foreign, but libc6 must be the i386 one */
+	dep, err = dependency.Parse("foreign-tool:i386, hello")
+	isok(t, err)
+	installed, err = resolver.Resolve(*dep)
+	isok(t, err)
+	assert(t, strings.Join(resolvedNames(installed), " ") ==
+		"foreign-tool:i386 hello:amd64 libc6:amd64 libc6:i386 make:amd64")
+}
+
+func TestResolveStepLimit(t *testing.T) {
+	resolver := newTestResolver(t)
+	dep, err := dependency.Parse("picky")
+	isok(t, err)
+
+	/* exim4 is tried (and fails) before postfix works out */
+	resolver.MaxSteps = 3
+	_, err = resolver.Resolve(*dep)
+	notok(t, err)
+	_, ok := err.(*control.UnsatisfiableError)
+	assert(t, !ok)
+	assert(t, strings.Contains(err.Error(), "Gave up"))
+
+	resolver.MaxSteps = 0
+	_, err = resolver.Resolve(*dep)
+	isok(t, err)
+}
+
+func TestResolveUnsatisfiable(t *testing.T) {
+	resolver := newTestResolver(t)
+
+	dep, err := dependency.Parse("broken")
+	isok(t, err)
+	_, err = resolver.Resolve(*dep)
+	notok(t, err)
+
+	unsat, ok := err.(*control.UnsatisfiableError)
+	assert(t, ok)
+	assert(t, len(unsat.Chain) == 2)
+	assert(t, unsat.Chain[0] == "'broken' is required")
+	assert(t, unsat.Chain[1] == "broken:amd64 (1.0-1) depends on 'libfoo (>= 2.0)'")
+	assert(t, strings.Contains(unsat.Reason, "libfoo:amd64 (1.0-1)"))
+
+	dep, err = dependency.Parse("nonexistent | hello (>= 3.0)")
+	isok(t, err)
+	_, err = resolver.Resolve(*dep)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -111,6 +111,75 @@ func toDecimal(input string) (int64, error) {
 
 // }}}
 
+// ArReader {{{
+
+// This struct reads a Debian .deb flavored `ar(1)` archive sequentially
+// from an io.Reader, such as a network stream or a pipe, in the same way
+// as tar.Reader. Unlike Ar, the Data member of the ArEntry is not set;
+// the contents of the current member are read from the ArReader itself.
+type ArReader struct {
+	in        io.Reader
+	remaining int64
+	padding   int64
+}
+
+// Create a new ArReader, and check that the stream looks like an `ar(1)`
+// archive.
+func NewArReader(in io.Reader) (*ArReader, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return nil, err
+	}
+	if string(header) != "!<arch>\n" {
+		return nil, fmt.Errorf("Header doesn't look right!")
+	}
+	return &ArReader{in: in}, nil
+}
+
+// Skip over whatever is left of the current member, and return the header
+// of the next one. io.EOF is returned at the end of the archive.
+func (r *ArReader) Next() (*ArEntry, error) {
+	if _, err := io.CopyN(io.Discard, r.in, r.remaining+r.padding); err != nil {
+		return nil, err
+	}
+	r.remaining, r.padding = 0, 0
+
+	line := make([]byte, 60)
+	count, err := io.ReadFull(r.in, line)
+	if err == io.EOF || (count == 1 && line[0] == '\n') {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Caught a short read at the end")
+	}
+	entry, err := parseArEntry(line)
+	if err != nil {
+		return nil, err
+	}
+
+	r.remaining = entry.Size
+	r.padding = entry.Size % 2
+	return entry, nil
+}
+
+// Read from the contents of the current member.
+func (r *ArReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	count, err := r.in.Read(p)
+	r.remaining -= int64(count)
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return count, err
+}
+
+// }}}
+
 // AR Format Hackery {{{
 
 // parseArEntry {{{
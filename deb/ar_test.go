@@ -1,10 +1,12 @@
 package deb_test
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"testing"
+	"testing/iotest"
 
 	"pault.ag/go/debian/deb"
 )
@@ -129,3 +131,59 @@ func TestArEmptyFields(t *testing.T) {
 	//isok(t, err)
 	//assert(t, string(firstContent) == string(firstRereadContent), "")
 }
+
+func TestArWriter(t *testing.T) {
+	out := bytes.Buffer{}
+	writer, err := deb.NewArWriter(&out)
+	isok(t, err)
+	isok(t, writer.WriteBytes(deb.ArEntry{Name: "hello.txt", Timestamp: 1361157466}, []byte("Hello world!\n")))
+	isok(t, writer.WriteBytes(deb.ArEntry{Name: "lamp.txt"}, []byte("I love lamp.\n")))
+	notok(t, writer.WriteBytes(deb.ArEntry{Name: "a-very-long-file-name.txt"}, []byte{}))
+
+	ar, err := deb.LoadAr(bytes.NewReader(out.Bytes()))
+	isok(t, err)
+
+	firstEntry, err := ar.Next()
+	isok(t, err)
+	assert(t, firstEntry.Name == "hello.txt")
+	assert(t, firstEntry.Timestamp == 1361157466)
+	assert(t, firstEntry.FileMode == "100644")
+	firstContent, err := io.ReadAll(firstEntry.Data)
+	isok(t, err)
+	assert(t, string(firstContent) == "Hello world!\n")
+
+	secondEntry, err := ar.Next()
+	isok(t, err)
+	secondContent, err := io.ReadAll(secondEntry.Data)
+	isok(t, err)
+	assert(t, string(secondContent) == "I love lamp.\n")
+
+	_, err = ar.Next()
+	assert(t, err == io.EOF)
+}
+
+func TestArReader(t *testing.T) {
+	file, err := os.Open("testdata/multi_archive.a")
+	isok(t, err)
+	defer file.Close()
+
+	ar, err := deb.NewArReader(iotest.OneByteReader(file))
+	isok(t, err)
+
+	firstEntry, err := ar.Next()
+	isok(t, err)
+	assert(t, firstEntry.Name == `hello.txt`)
+	assert(t, firstEntry.Timestamp == 1361157466)
+	assert(t, firstEntry.Data == nil)
+
+	/* Skip over the first member without reading it */
+	secondEntry, err := ar.Next()
+	isok(t, err)
+	secondContent, err := io.ReadAll(ar)
+	isok(t, err)
+	assert(t, secondEntry.Size == int64(len(secondContent)))
+	assert(t, string(secondContent) == "I love lamp.\n")
+
+	_, err = ar.Next()
+	assert(t, err == io.EOF)
+}
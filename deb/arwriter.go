@@ -0,0 +1,93 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ArWriter {{{
+
+// This struct writes out a Debian .deb flavored `ar(1)` archive, one member
+// at a time, in the same format that is read by `LoadAr`.
+type ArWriter struct {
+	out io.Writer
+}
+
+// Create a new ArWriter, and write the `ar(1)` global header to the
+// underlying io.Writer.
+func NewArWriter(out io.Writer) (*ArWriter, error) {
+	if _, err := io.WriteString(out, "!<arch>\n"); err != nil {
+		return nil, err
+	}
+	return &ArWriter{out: out}, nil
+}
+
+// Write a new member to the archive. The header of the member is taken
+// from the ArEntry (the Data member is ignored), and exactly `entry.Size`
+// bytes are copied from `data` to the archive.
+//
+// The member name must be no longer than 16 characters, since the
+// extended naming schemes are not permitted in a .deb.
+func (w *ArWriter) WriteEntry(entry ArEntry, data io.Reader) error {
+	if len(entry.Name) == 0 || len(entry.Name) > 16 {
+		return fmt.Errorf("Invalid ar member name: '%s'", entry.Name)
+	}
+	mode := entry.FileMode
+	if mode == "" {
+		mode = "100644"
+	}
+
+	header := fmt.Sprintf(
+		"%-16s%-12d%-6d%-6d%-8s%-10d`\n",
+		entry.Name, entry.Timestamp, entry.OwnerID, entry.GroupID, mode, entry.Size,
+	)
+	if len(header) != 60 {
+		return fmt.Errorf("Malformed file entry for '%s'", entry.Name)
+	}
+	if _, err := io.WriteString(w.out, header); err != nil {
+		return err
+	}
+
+	count, err := io.CopyN(w.out, data, entry.Size)
+	if err != nil {
+		return err
+	}
+	if count%2 != 0 {
+		if _, err := w.out.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write a new member to the archive from an in-memory buffer, setting the
+// Size of the entry from the length of `data`.
+func (w *ArWriter) WriteBytes(entry ArEntry, data []byte) error {
+	entry.Size = int64(len(data))
+	return w.WriteEntry(entry, bytes.NewReader(data))
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,427 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"archive/tar"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/hashio"
+)
+
+// Builder {{{
+
+// Names of the control.tar members which are executable.
+var maintainerScripts = map[string]bool{
+	"preinst":  true,
+	"postinst": true,
+	"prerm":    true,
+	"postrm":   true,
+	"config":   true,
+}
+
+// A Builder creates a `.deb` from a Control file, a set of control.tar
+// members (such as maintainer scripts), and a tree of files to ship in
+// data.tar, in the same way as `dpkg-deb --build`.
+//
+// The output is deterministic: every member of the archives is owned by
+// root, entries are written in sorted order, and every timestamp is set
+// to ModTime, which allows for reproducible builds.
+type Builder struct {
+	// Control file of the package. If InstalledSize is not set, it will be
+	// computed from the files in Data.
+	Control Control
+
+	// Extra members of control.tar, keyed by name, such as "postinst",
+	// "triggers" or "shlibs". Maintainer scripts are written out as
+	// executable. The control, md5sums and conffiles members are created
+	// by the Builder, and may not be set here.
+	ControlMembers map[string][]byte
+
+	// Absolute paths of the files in Data which are conffiles.
+	Conffiles []string
+
+	// Tree of files to install, rooted at the filesystem root.
+	Data fs.FS
+
+	// Compression to use for control.tar and data.tar, one of "gz",
+	// "xz", "zst" or "none". Defaults to "xz".
+	Compression string
+
+	// Timestamp to use for every member of the `.deb`. Defaults to
+	// SourceDateEpoch().
+	ModTime time.Time
+}
+
+// Create a new Builder for a `.deb` containing all the files in `data`.
+func NewBuilder(debControl Control, data fs.FS) *Builder {
+	return &Builder{
+		Control:        debControl,
+		ControlMembers: map[string][]byte{},
+		Conffiles:      []string{},
+		Data:           data,
+	}
+}
+
+// Create a new Builder for a `.deb` containing all the files under the
+// directory `root`, including symlinks.
+func NewBuilderFromDirectory(debControl Control, root string) *Builder {
+	return NewBuilder(debControl, directoryFS{FS: os.DirFS(root), root: root})
+}
+
+// Return the timestamp set by the SOURCE_DATE_EPOCH environment variable
+// (see https://reproducible-builds.org/specs/source-date-epoch/), or the
+// current time if it's not set.
+func SourceDateEpoch() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Malformed SOURCE_DATE_EPOCH: %w", err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// Write the `.deb` to the file at `path`.
+func (b *Builder) WriteFile(path string) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := b.Write(fd); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// Write the `.deb` to the io.Writer.
+func (b *Builder) Write(out io.Writer) error {
+	modTime := b.ModTime
+	if modTime.IsZero() {
+		var err error
+		if modTime, err = SourceDateEpoch(); err != nil {
+			return err
+		}
+	}
+
+	ext, compressor, err := builderCompressor(b.Compression)
+	if err != nil {
+		return err
+	}
+
+	/* data.tar is written out first, to a temporary file (since it may be
+	 * large), so that we can fill in the md5sums and Installed-Size. */
+	dataFile, err := os.CreateTemp("", "data.tar.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dataFile.Name())
+	defer dataFile.Close()
+
+	summary, err := b.writeDataTar(dataFile, compressor, modTime)
+	if err != nil {
+		return err
+	}
+	dataSize, err := dataFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := dataFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	controlTar := bytes.Buffer{}
+	if err := b.writeControlTar(&controlTar, compressor, modTime, summary); err != nil {
+		return err
+	}
+
+	ar, err := NewArWriter(out)
+	if err != nil {
+		return err
+	}
+	for _, member := range []struct {
+		name string
+		size int64
+		data io.Reader
+	}{
+		{"debian-binary", 4, strings.NewReader("2.0\n")},
+		{"control.tar" + ext, int64(controlTar.Len()), &controlTar},
+		{"data.tar" + ext, dataSize, dataFile},
+	} {
+		if err := ar.WriteEntry(ArEntry{
+			Name:      member.name,
+			Timestamp: modTime.Unix(),
+			FileMode:  "100644",
+			Size:      member.size,
+		}, member.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// Builder Internals {{{
+
+// An fs.FS over a directory on disk, which can also read symlinks.
+type directoryFS struct {
+	fs.FS
+	root string
+}
+
+func (d directoryFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(d.root, filepath.FromSlash(name)))
+}
+
+// Information about the data.tar needed to write out the control.tar.
+type dataSummary struct {
+	md5sums       []byte
+	installedSize int
+}
+
+// Return the file extension and compressor for the named compression.
+func builderCompressor(name string) (string, hashio.Compressor, error) {
+	switch name {
+	case "":
+		name = "xz"
+	case "none":
+		return "", func(out io.Writer) (io.WriteCloser, error) {
+			return nopWriteCloser{out}, nil
+		}, nil
+	}
+	compressor, err := hashio.GetCompressor(name)
+	if err != nil {
+		return "", nil, err
+	}
+	return "." + name, compressor, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Create a tar header for a member of a .deb tarball, owned by root.
+func newBuilderHeader(name string, typeflag byte, mode int64, modTime time.Time) *tar.Header {
+	return &tar.Header{
+		Typeflag: typeflag,
+		Name:     name,
+		Mode:     mode,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  modTime,
+		Format:   tar.FormatGNU,
+	}
+}
+
+// Convert the permission bits of an fs.FileMode to those used in a tar
+// header, keeping the setuid, setgid and sticky bits.
+func tarMode(mode fs.FileMode) int64 {
+	ret := int64(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		ret |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		ret |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		ret |= 01000
+	}
+	return ret
+}
+
+// Write out data.tar, compressed with `compressor`, and return the
+// md5sums and Installed-Size of its contents.
+func (b *Builder) writeDataTar(out io.Writer, compressor hashio.Compressor, modTime time.Time) (*dataSummary, error) {
+	compressed, err := compressor(out)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(compressed)
+
+	md5sums := bytes.Buffer{}
+	installedSize := 0
+
+	readLink, _ := b.Data.(interface {
+		ReadLink(name string) (string, error)
+	})
+
+	err = fs.WalkDir(b.Data, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		mode := tarMode(info.Mode())
+
+		name := "./"
+		if path != "." {
+			name = "./" + path
+		}
+
+		switch {
+		case entry.IsDir():
+			installedSize++
+			if path != "." {
+				name += "/"
+			}
+			return tw.WriteHeader(newBuilderHeader(name, tar.TypeDir, mode, modTime))
+		case entry.Type()&fs.ModeSymlink != 0:
+			if readLink == nil {
+				return fmt.Errorf("Can't read symlink '%s' from this filesystem", path)
+			}
+			target, err := readLink.ReadLink(path)
+			if err != nil {
+				return err
+			}
+			installedSize++
+			header := newBuilderHeader(name, tar.TypeSymlink, 0777, modTime)
+			header.Linkname = target
+			return tw.WriteHeader(header)
+		case entry.Type().IsRegular():
+			fd, err := b.Data.Open(path)
+			if err != nil {
+				return err
+			}
+			defer fd.Close()
+
+			header := newBuilderHeader(name, tar.TypeReg, mode, modTime)
+			header.Size = info.Size()
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			hash := md5.New()
+			if _, err := io.CopyN(io.MultiWriter(tw, hash), fd, info.Size()); err != nil {
+				return err
+			}
+			installedSize += int((info.Size() + 1023) / 1024)
+			fmt.Fprintf(&md5sums, "%x  %s\n", hash.Sum(nil), path)
+			return nil
+		default:
+			return fmt.Errorf("Unsupported file type for '%s': %s", path, info.Mode().Type())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := compressed.Close(); err != nil {
+		return nil, err
+	}
+	return &dataSummary{md5sums: md5sums.Bytes(), installedSize: installedSize}, nil
+}
+
+// Write out control.tar, compressed with `compressor`.
+func (b *Builder) writeControlTar(
+	out io.Writer,
+	compressor hashio.Compressor,
+	modTime time.Time,
+	summary *dataSummary,
+) error {
+	debControl := b.Control
+	if debControl.InstalledSize == 0 {
+		debControl.InstalledSize = summary.installedSize
+	}
+	controlFile := bytes.Buffer{}
+	if err := control.Marshal(&controlFile, debControl); err != nil {
+		return err
+	}
+
+	members := map[string][]byte{}
+	for name, data := range b.ControlMembers {
+		switch name {
+		case "control", "md5sums", "conffiles":
+			return fmt.Errorf("The '%s' control member is created by the Builder", name)
+		}
+		members[name] = data
+	}
+	members["control"] = controlFile.Bytes()
+	if len(summary.md5sums) > 0 {
+		members["md5sums"] = summary.md5sums
+	}
+	if len(b.Conffiles) > 0 {
+		members["conffiles"] = []byte(strings.Join(b.Conffiles, "\n") + "\n")
+	}
+
+	names := []string{}
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compressed, err := compressor(out)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(compressed)
+	if err := tw.WriteHeader(newBuilderHeader("./", tar.TypeDir, 0755, modTime)); err != nil {
+		return err
+	}
+	for _, name := range names {
+		mode := int64(0644)
+		if maintainerScripts[name] {
+			mode = 0755
+		}
+		header := newBuilderHeader("./"+name, tar.TypeReg, mode, modTime)
+		header.Size = int64(len(members[name]))
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(members[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,108 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+func newTestBuilder(t *testing.T, compression string) *deb.Builder {
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	builder := deb.NewBuilder(deb.Control{
+		Package:      "hello",
+		Architecture: *arch,
+		Maintainer:   "Paul Tagliamonte <paultag@debian.org>",
+		Description:  "example package\nThis is an example package.",
+	}, fstest.MapFS{
+		"etc":            {Mode: fs.ModeDir | 0755},
+		"etc/hello.conf": {Data: []byte("greeting=hello\n"), Mode: 0644},
+		"usr":            {Mode: fs.ModeDir | 0755},
+		"usr/bin":        {Mode: fs.ModeDir | 0755},
+		"usr/bin/hello":  {Data: []byte("#!/bin/sh\necho hello\n"), Mode: 0755},
+	})
+	builder.Control.Version.Version = "1.0"
+	builder.ControlMembers["postinst"] = []byte("#!/bin/sh\nexit 0\n")
+	builder.Conffiles = []string{"/etc/hello.conf"}
+	builder.Compression = compression
+	builder.ModTime = time.Unix(1700000000, 0)
+	return builder
+}
+
+func TestBuild(t *testing.T) {
+	for _, compression := range []string{"gz", "xz", "zst", "none"} {
+		out := bytes.Buffer{}
+		isok(t, newTestBuilder(t, compression).Write(&out))
+
+		/* The output should be reproducible */
+		again := bytes.Buffer{}
+		isok(t, newTestBuilder(t, compression).Write(&again))
+		assert(t, bytes.Equal(out.Bytes(), again.Bytes()))
+
+		debFile, err := deb.Load(bytes.NewReader(out.Bytes()), "hello.deb")
+		isok(t, err)
+		assert(t, debFile.Control.Package == "hello")
+		assert(t, debFile.Control.Version.Version == "1.0")
+		assert(t, debFile.Control.InstalledSize == 6)
+		if compression == "none" {
+			assert(t, debFile.DataExt == "tar")
+		} else {
+			assert(t, debFile.DataExt == "tar."+compression)
+		}
+
+		names := []string{}
+		for {
+			header, err := debFile.Data.Next()
+			if err == io.EOF {
+				break
+			}
+			isok(t, err)
+			assert(t, header.Uid == 0 && header.Uname == "root")
+			assert(t, header.ModTime.Unix() == 1700000000)
+			names = append(names, header.Name)
+			if header.Name == "./usr/bin/hello" {
+				assert(t, header.Mode == 0755)
+				content, err := io.ReadAll(debFile.Data)
+				isok(t, err)
+				assert(t, string(content) == "#!/bin/sh\necho hello\n")
+			}
+		}
+		assert(t, len(names) == 6)
+		assert(t, names[0] == "./")
+		assert(t, names[5] == "./usr/bin/hello")
+		isok(t, debFile.Close())
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,281 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/changelog"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/hashio"
+	"pault.ag/go/debian/internal"
+)
+
+// ChangesBuilder {{{
+
+// A ChangesBuilder creates the `.changes` file for an upload from the
+// changelog entry being uploaded, and the files that were built, in the
+// same way as `dpkg-genchanges`.
+type ChangesBuilder struct {
+	// Changelog entry being uploaded. The Source, Version, Distribution,
+	// Urgency, Changed-By, Date, Closes and Changes fields are taken
+	// from it.
+	Entry changelog.ChangelogEntry
+
+	// Maintainer of the package. Defaults to the Maintainer of the DSC,
+	// or of the first `.deb`.
+	Maintainer string
+
+	// Source package to upload, if any. The `.dsc`, and every file it
+	// lists, are added to the upload. DSC.Filename must be set.
+	DSC *control.DSC
+
+	// Paths to the `.deb` files to upload.
+	Debs []string
+
+	// Paths to the `.buildinfo` files to upload.
+	BuildInfos []string
+
+	// Section and Priority of the source package, used in the Files
+	// entries of the source and `.buildinfo` files. Both default to "-".
+	Section  string
+	Priority string
+
+	// If set, the `.changes` is clearsigned by this entity when written.
+	Signer *openpgp.Entity
+}
+
+// Create a new ChangesBuilder for the upload described by `entry`.
+func NewChangesBuilder(entry changelog.ChangelogEntry) *ChangesBuilder {
+	return &ChangesBuilder{
+		Entry:      entry,
+		Debs:       []string{},
+		BuildInfos: []string{},
+	}
+}
+
+// Changes {{{
+
+// Create the control.Changes for the upload. Every file is read to
+// compute its checksums, and every `.deb` must have been built from
+// the source package named in the changelog entry.
+func (b *ChangesBuilder) Changes() (*control.Changes, error) {
+	section := internal.OrDash(b.Section)
+	priority := internal.OrDash(b.Priority)
+
+	changes := control.Changes{
+		Format:          "1.8",
+		Date:            b.Entry.When.Format(time.RFC1123Z),
+		Source:          b.Entry.Source,
+		Binaries:        []string{},
+		Architectures:   []dependency.Arch{},
+		Version:         b.Entry.Version,
+		Distribution:    b.Entry.Target,
+		Urgency:         b.Entry.Arguments["urgency"],
+		Maintainer:      b.Maintainer,
+		ChangedBy:       b.Entry.ChangedBy,
+		Closes:          b.Entry.Closes(),
+		Changes:         changesText(b.Entry),
+		ChecksumsSha1:   []control.SHA1FileHash{},
+		ChecksumsSha256: []control.SHA256FileHash{},
+		Files:           []control.FileListChangesFileHash{},
+	}
+
+	if b.DSC != nil {
+		if changes.Maintainer == "" {
+			changes.Maintainer = b.DSC.Maintainer
+		}
+		source, err := dependency.ParseArch("source")
+		if err != nil {
+			return nil, err
+		}
+		changes.Architectures = append(changes.Architectures, *source)
+		if err := addChangesFile(&changes, b.DSC.Filename, section, priority); err != nil {
+			return nil, err
+		}
+		for _, file := range b.DSC.AbsFiles() {
+			if err := addChangesFile(&changes, file.Filename, section, priority); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	binaries := map[string]bool{}
+	arches := map[string]dependency.Arch{}
+	for _, path := range b.Debs {
+		debFile, closer, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		debControl := debFile.Control
+		closer()
+
+		if debControl.SourceName() != b.Entry.Source {
+			return nil, fmt.Errorf(
+				"%s was built from %s, not %s",
+				path, debControl.SourceName(), b.Entry.Source,
+			)
+		}
+		if changes.Maintainer == "" {
+			changes.Maintainer = debControl.Maintainer
+		}
+		binaries[debControl.Package] = true
+		arches[debControl.Architecture.String()] = debControl.Architecture
+
+		if err := addChangesFile(
+			&changes, path, internal.OrDash(debControl.Section), internal.OrDash(debControl.Priority),
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range b.BuildInfos {
+		if err := addChangesFile(&changes, path, section, priority); err != nil {
+			return nil, err
+		}
+	}
+
+	for binary := range binaries {
+		changes.Binaries = append(changes.Binaries, binary)
+	}
+	sort.Strings(changes.Binaries)
+
+	archNames := []string{}
+	for name := range arches {
+		archNames = append(archNames, name)
+	}
+	sort.Strings(archNames)
+	for _, name := range archNames {
+		changes.Architectures = append(changes.Architectures, arches[name])
+	}
+
+	if len(changes.Files) == 0 {
+		return nil, fmt.Errorf("No files to upload")
+	}
+
+	return &changes, nil
+}
+
+// }}}
+
+// Write {{{
+
+// Write the `.changes` to the file at `path`.
+func (b *ChangesBuilder) WriteFile(path string) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := b.Write(fd); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// Write the `.changes` to the io.Writer, clearsigned if Signer is set.
+func (b *ChangesBuilder) Write(out io.Writer) error {
+	changes, err := b.Changes()
+	if err != nil {
+		return err
+	}
+
+	if b.Signer == nil {
+		return control.Marshal(out, changes)
+	}
+
+	plaintext := bytes.Buffer{}
+	if err := control.Marshal(&plaintext, changes); err != nil {
+		return err
+	}
+	return control.Clearsign(out, plaintext.Bytes(), b.Signer)
+}
+
+// }}}
+
+// Internals {{{
+
+// Format the changelog entry for the Changes field: the entry's header
+// line, followed by a blank line and the changes themselves.
+func changesText(entry changelog.ChangelogEntry) string {
+	arguments := []string{}
+	for key, value := range entry.Arguments {
+		arguments = append(arguments, key+"="+value)
+	}
+	sort.Strings(arguments)
+
+	header := fmt.Sprintf("%s (%s) %s", entry.Source, entry.Version, entry.Target)
+	if len(arguments) != 0 {
+		header = header + "; " + strings.Join(arguments, ", ")
+	}
+	return header + "\n\n" + strings.Trim(entry.Changelog, "\n")
+}
+
+// Hash the file at `path`, and add it to the Checksums-Sha1,
+// Checksums-Sha256 and Files fields of `changes`.
+func addChangesFile(changes *control.Changes, path, section, priority string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	reader, hashers, err := hashio.NewHasherReaders(
+		[]string{"md5", "sha1", "sha256"},
+		fd,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return err
+	}
+
+	filename := filepath.Base(path)
+	changes.Files = append(changes.Files, control.FileListChangesFileHash{
+		FileHash:  control.FileHashFromHasher(filename, *hashers[0]),
+		Component: section,
+		Priority:  priority,
+	})
+	changes.ChecksumsSha1 = append(changes.ChecksumsSha1, control.SHA1FileHash{
+		FileHash: control.FileHashFromHasher(filename, *hashers[1]),
+	})
+	changes.ChecksumsSha256 = append(changes.ChecksumsSha256, control.SHA256FileHash{
+		FileHash: control.FileHashFromHasher(filename, *hashers[2]),
+	})
+	return nil
+}
+
+// }}}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,153 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/changelog"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+// Test Source Package {{{
+const testChangelog = `hello (1.0) unstable; urgency=medium
+
+  * Initial release. (Closes: #1234)
+
+ -- Paul Tagliamonte <paultag@debian.org>  Tue, 14 Nov 2023 22:13:20 +0000
+`
+
+const testDSC = `Format: 3.0 (native)
+Source: hello
+Binary: hello
+Architecture: any
+Version: 1.0
+Maintainer: Paul Tagliamonte <paultag@debian.org>
+Checksums-Sha256:
+ b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c 4 hello_1.0.tar.xz
+Files:
+ d3b07384d113edec49eaa6238ad5ff00 4 hello_1.0.tar.xz
+`
+
+// }}}
+
+func newTestChangesBuilder(t *testing.T) *deb.ChangesBuilder {
+	dir := t.TempDir()
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_1.0.dsc"), []byte(testDSC), 0644))
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_1.0.tar.xz"), []byte("foo\n"), 0644))
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_1.0_amd64.buildinfo"), []byte("Format: 1.0\n"), 0644))
+	isok(t, newTestBuilder(t, "xz").WriteFile(filepath.Join(dir, "hello_1.0_amd64.deb")))
+
+	entry, err := changelog.ParseOne(bufio.NewReader(strings.NewReader(testChangelog)))
+	isok(t, err)
+	dsc, err := control.ParseDscFile(filepath.Join(dir, "hello_1.0.dsc"))
+	isok(t, err)
+
+	builder := deb.NewChangesBuilder(*entry)
+	builder.DSC = dsc
+	builder.Debs = []string{filepath.Join(dir, "hello_1.0_amd64.deb")}
+	builder.BuildInfos = []string{filepath.Join(dir, "hello_1.0_amd64.buildinfo")}
+	builder.Section = "devel"
+	return builder
+}
+
+func TestChangesBuilder(t *testing.T) {
+	out := bytes.Buffer{}
+	isok(t, newTestChangesBuilder(t).Write(&out))
+
+	changes, err := control.ParseChanges(bufio.NewReader(&out), "hello_1.0_amd64.changes")
+	isok(t, err)
+	assert(t, changes.Format == "1.8")
+	assert(t, changes.Date == "Tue, 14 Nov 2023 22:13:20 +0000")
+	assert(t, changes.Source == "hello")
+	assert(t, changes.Version.String() == "1.0")
+	assert(t, changes.Distribution == "unstable")
+	assert(t, changes.Urgency == "medium")
+	assert(t, changes.Maintainer == "Paul Tagliamonte <paultag@debian.org>")
+	assert(t, changes.ChangedBy == "Paul Tagliamonte <paultag@debian.org>")
+	assert(t, len(changes.Binaries) == 1 && changes.Binaries[0] == "hello")
+	assert(t, len(changes.Architectures) == 2)
+	assert(t, changes.Architectures[0].String() == "source")
+	assert(t, changes.Architectures[1].String() == "amd64")
+	assert(t, len(changes.Closes) == 1 && changes.Closes[0] == "1234")
+	assert(t, changes.Changes ==
+		"hello (1.0) unstable; urgency=medium\n\n  * Initial release. (Closes: #1234)\n")
+
+	assert(t, len(changes.Files) == 4)
+	assert(t, len(changes.ChecksumsSha1) == 4)
+	assert(t, len(changes.ChecksumsSha256) == 4)
+
+	tarball := changes.Files[1]
+	assert(t, tarball.Filename == "hello_1.0.tar.xz")
+	assert(t, tarball.Hash == "d3b07384d113edec49eaa6238ad5ff00")
+	assert(t, tarball.Size == 4)
+	assert(t, tarball.Component == "devel" && tarball.Priority == "-")
+	assert(t, changes.ChecksumsSha256[1].Hash ==
+		"b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+
+	/* Section and Priority of a .deb come from its control file */
+	binary := changes.Files[2]
+	assert(t, binary.Filename == "hello_1.0_amd64.deb")
+	assert(t, binary.Component == "-" && binary.Priority == "-")
+	assert(t, changes.Files[3].Filename == "hello_1.0_amd64.buildinfo")
+}
+
+func TestChangesBuilderSigned(t *testing.T) {
+	builder := newTestChangesBuilder(t)
+	builder.Signer = loadTestKeyring(t, "secring.gpg")[0]
+	out := bytes.Buffer{}
+	isok(t, builder.Write(&out))
+	assert(t, strings.HasPrefix(out.String(), "-----BEGIN PGP SIGNED MESSAGE-----"))
+
+	keyring := loadTestKeyring(t, "pubring.gpg")
+	reader, err := control.NewParagraphReader(&out, &keyring)
+	isok(t, err)
+	assert(t, reader.Signer() != nil)
+	paragraph, err := reader.Next()
+	isok(t, err)
+	assert(t, paragraph.Values["Source"] == "hello")
+}
+
+func TestChangesBuilderWrongSource(t *testing.T) {
+	builder := newTestChangesBuilder(t)
+	builder.Entry.Source = "goodbye"
+	_, err := builder.Changes()
+	notok(t, err)
+
+	builder = newTestChangesBuilder(t)
+	builder.DSC = nil
+	builder.Debs = []string{}
+	builder.BuildInfos = []string{}
+	_, err = builder.Changes()
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
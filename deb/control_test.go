@@ -0,0 +1,116 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+func loadTestControl(t *testing.T, name string) (deb.Control, []byte) {
+	data, err := os.ReadFile(filepath.Join("testdata", "control", name))
+	isok(t, err)
+	debControl := deb.Control{}
+	isok(t, control.Unmarshal(&debControl, bytes.NewReader(data)))
+	return debControl, data
+}
+
+func TestControlRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "control", "*"))
+	isok(t, err)
+	assert(t, len(paths) > 0)
+
+	for _, path := range paths {
+		debControl, data := loadTestControl(t, filepath.Base(path))
+		out := bytes.Buffer{}
+		isok(t, control.Marshal(&out, debControl))
+		if out.String() != string(data) {
+			t.Fatalf("%s did not round-trip:\n%s", path, out.String())
+		}
+	}
+}
+
+func TestControlFields(t *testing.T) {
+	dpkg, _ := loadTestControl(t, "dpkg")
+	assert(t, dpkg.Essential)
+	assert(t, !dpkg.Protected)
+	assert(t, len(dpkg.PreDepends.Relations) == 7)
+	assert(t, dpkg.PreDepends.Relations[1].Possibilities[0].Name == "libc6")
+	assert(t, len(dpkg.Conffiles) == 5)
+	assert(t, dpkg.Conffiles[2].Path == "/etc/dpkg/dpkg.cfg")
+	assert(t, dpkg.Conffiles[2].Hash == "f4413ffb515f8f753624ae3bb365b81b")
+
+	libcrypt, _ := loadTestControl(t, "libcrypt1")
+	assert(t, libcrypt.Protected)
+	assert(t, !libcrypt.Essential)
+
+	buildEssential, _ := loadTestControl(t, "build-essential")
+	assert(t, buildEssential.BuildEssential)
+
+	csh, _ := loadTestControl(t, "csh")
+	assert(t, csh.OriginalMaintainer == "Alastair McKinstry <mckinstry@debian.org>")
+
+	certspotter, _ := loadTestControl(t, "certspotter")
+	assert(t, len(certspotter.StaticBuiltUsing.Relations) == 5)
+	assert(t, certspotter.StaticBuiltUsing.Relations[0].Possibilities[0].Version.Number == "1.19.6-2")
+
+	python3Dev, _ := loadTestControl(t, "python3-dev")
+	assert(t, len(python3Dev.BuiltUsing.Relations) == 1)
+	assert(t, python3Dev.BuiltUsing.Relations[0].Possibilities[0].Name == "sphinx")
+
+	vimRuntime, _ := loadTestControl(t, "vim-runtime")
+	assert(t, len(vimRuntime.Enhances.Relations) == 1)
+	assert(t, vimRuntime.Enhances.Relations[0].Possibilities[0].Name == "vim-tiny")
+
+	bash, _ := loadTestControl(t, "bash")
+	assert(t, len(bash.Conflicts.Relations) == 1)
+	assert(t, bash.Conflicts.Relations[0].Possibilities[0].Name == "bash-completion")
+	assert(t, len(bash.Replaces.Relations) == 2)
+	assert(t, bash.Replaces.Relations[0].Possibilities[0].Name == "bash-completion")
+	assert(t, bash.Replaces.Relations[1].Possibilities[0].Name == "bash-doc")
+
+	/* Built-For-Profiles isn't set on any packages in the archive yet */
+	profiled := deb.Control{}
+	isok(t, control.Unmarshal(&profiled, strings.NewReader(
+		"Package: foo\nVersion: 1.0\nArchitecture: all\nBuilt-For-Profiles: nocheck nodoc\n",
+	)))
+	assert(t, len(profiled.BuiltForProfiles) == 2)
+	assert(t, profiled.BuiltForProfiles[1] == "nodoc")
+
+	/* Unset booleans aren't written out */
+	out := bytes.Buffer{}
+	profiled.Protected = true
+	isok(t, control.Marshal(&out, profiled))
+	assert(t, out.String() == "Package: foo\nVersion: 1.0\nArchitecture: all\n"+
+		"Built-For-Profiles: nocheck nodoc\nProtected: yes\n")
+}
+
+// vim: foldmethod=marker
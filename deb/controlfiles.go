@@ -0,0 +1,373 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"archive/tar"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// ControlFiles {{{
+
+// ControlFiles holds every member of the control.tar of a `.deb` other
+// than the control file itself (which is parsed into Deb.Control), such as
+// the maintainer scripts, conffiles, md5sums, shlibs, symbols, triggers and
+// debconf templates. The Get* methods parse the well known members into
+// their typed representations.
+type ControlFiles struct {
+	Members map[string][]byte
+}
+
+// Return the raw contents of the named control.tar member, and whether it
+// was present in the `.deb`.
+func (c *ControlFiles) Get(name string) ([]byte, bool) {
+	data, ok := c.Members[name]
+	return data, ok
+}
+
+// Return the maintainer scripts (preinst, postinst, prerm and postrm, as
+// well as the debconf config script) that are present in the `.deb`,
+// keyed by name.
+func (c *ControlFiles) MaintainerScripts() map[string][]byte {
+	ret := map[string][]byte{}
+	for name := range maintainerScripts {
+		if data, ok := c.Members[name]; ok {
+			ret[name] = data
+		}
+	}
+	return ret
+}
+
+// Return the names of all members which aren't otherwise understood by
+// ControlFiles, in sorted order.
+func (c *ControlFiles) Other() []string {
+	ret := []string{}
+	for name := range c.Members {
+		switch name {
+		case "conffiles", "md5sums", "shlibs", "symbols", "triggers", "templates":
+			continue
+		}
+		if maintainerScripts[name] {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Read every regular file out of control.tar, keeping the control file
+// separate from the rest of the members.
+func readControlTar(archive *tar.Reader) ([]byte, *ControlFiles, error) {
+	var controlFile []byte
+	ret := ControlFiles{Members: map[string][]byte{}}
+
+	for {
+		member, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if member.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := strings.TrimPrefix(path.Clean(member.Name), "/")
+		if name == "control" {
+			controlFile = data
+			continue
+		}
+		ret.Members[name] = data
+	}
+
+	if controlFile == nil {
+		return nil, nil, fmt.Errorf("Missing or out of order .deb member 'control'")
+	}
+	return controlFile, &ret, nil
+}
+
+// Iterate over the lines of a control.tar member, skipping empty lines
+// and comments.
+func controlFileLines(data []byte) []string {
+	ret := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	return ret
+}
+
+// }}}
+
+// Conffiles {{{
+
+// A Conffile is an entry in the conffiles control member, which lists the
+// configuration files that dpkg should preserve over upgrades, or in the
+// Conffiles field of the dpkg status file, which also records the MD5
+// hash of each conffile as installed.
+type Conffile struct {
+	Path string
+	// Only set for entries in the Conffiles field.
+	Hash  string
+	Flags []string
+}
+
+// Parse an entry of the Conffiles field, such as
+// "/etc/dpkg/dpkg.cfg f4413ffb515f8f753624ae3bb365b81b obsolete".
+func (c *Conffile) UnmarshalControl(data string) error {
+	fields := strings.Fields(data)
+	if len(fields) < 2 {
+		return fmt.Errorf("Malformed Conffiles entry: '%s'", data)
+	}
+	c.Path = fields[0]
+	c.Hash = fields[1]
+	c.Flags = fields[2:]
+	return nil
+}
+
+func (c Conffile) MarshalControl() (string, error) {
+	return strings.Join(append([]string{c.Path, c.Hash}, c.Flags...), " "), nil
+}
+
+// Parse the conffiles control member. Each line is the absolute path of
+// a conffile, optionally preceded by flags such as "remove-on-upgrade".
+func (c *ControlFiles) GetConffiles() []Conffile {
+	ret := []Conffile{}
+	for _, line := range controlFileLines(c.Members["conffiles"]) {
+		fields := strings.Fields(line)
+		ret = append(ret, Conffile{
+			Path:  fields[len(fields)-1],
+			Flags: fields[:len(fields)-1],
+		})
+	}
+	return ret
+}
+
+// }}}
+
+// MD5Sums {{{
+
+// An MD5Sum is an entry in the md5sums control member, which holds the
+// MD5 hash of a file shipped in data.tar. The Path is relative to the
+// root of the filesystem, without a leading slash.
+type MD5Sum struct {
+	Hash string
+	Path string
+}
+
+// Parse the md5sums control member.
+func (c *ControlFiles) GetMD5Sums() ([]MD5Sum, error) {
+	ret := []MD5Sum{}
+	for _, line := range controlFileLines(c.Members["md5sums"]) {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || len(fields[0]) != 32 {
+			return nil, fmt.Errorf("Malformed md5sums line: '%s'", line)
+		}
+		/* md5sum(1) marks binary mode files with a '*' */
+		filePath := strings.TrimLeft(fields[1], " *")
+		ret = append(ret, MD5Sum{
+			Hash: strings.ToLower(fields[0]),
+			Path: strings.TrimPrefix(filePath, "/"),
+		})
+	}
+	return ret, nil
+}
+
+// }}}
+
+// Shlibs {{{
+
+// A Shlib is an entry in the shlibs control member, which maps a shared
+// library's SONAME to the dependency needed to use it.
+type Shlib struct {
+	// Optional package type the entry applies to, such as "udeb".
+	Type       string
+	Library    string
+	Version    string
+	Dependency dependency.Dependency
+}
+
+// Parse the shlibs control member.
+func (c *ControlFiles) GetShlibs() ([]Shlib, error) {
+	ret := []Shlib{}
+	for _, line := range controlFileLines(c.Members["shlibs"]) {
+		fields := strings.Fields(line)
+		shlib := Shlib{}
+		if len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+			shlib.Type = strings.TrimSuffix(fields[0], ":")
+			fields = fields[1:]
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("Malformed shlibs line: '%s'", line)
+		}
+		shlib.Library = fields[0]
+		shlib.Version = fields[1]
+		if len(fields) > 2 {
+			dep, err := dependency.Parse(strings.Join(fields[2:], " "))
+			if err != nil {
+				return nil, err
+			}
+			shlib.Dependency = *dep
+		}
+		ret = append(ret, shlib)
+	}
+	return ret, nil
+}
+
+// }}}
+
+// Symbols {{{
+
+// A Symbol is an exported symbol of a shared library, as listed in the
+// symbols control member.
+type Symbol struct {
+	Name       string
+	MinVersion string
+	// Index into the SymbolsLibrary's Dependencies of the dependency
+	// template needed for this symbol.
+	DependencyID int
+}
+
+// A SymbolsLibrary is the entry for a single shared library in the symbols
+// control member. See deb-symbols(5).
+type SymbolsLibrary struct {
+	Library string
+	// Dependency templates (such as "libfoo1 #MINVER#"), starting with the
+	// main one, followed by any alternative ones from "|" lines.
+	Dependencies []string
+	// Meta-information fields, such as "Build-Depends-Package".
+	Fields  map[string]string
+	Symbols []Symbol
+}
+
+// Parse the symbols control member.
+func (c *ControlFiles) GetSymbols() ([]SymbolsLibrary, error) {
+	ret := []SymbolsLibrary{}
+	var current *SymbolsLibrary
+
+	for _, line := range controlFileLines(c.Members["symbols"]) {
+		switch {
+		case !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "|") && !strings.HasPrefix(line, "*"):
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("Malformed symbols line: '%s'", line)
+			}
+			ret = append(ret, SymbolsLibrary{
+				Library:      fields[0],
+				Dependencies: []string{strings.TrimSpace(fields[1])},
+				Fields:       map[string]string{},
+				Symbols:      []Symbol{},
+			})
+			current = &ret[len(ret)-1]
+		case current == nil:
+			return nil, fmt.Errorf("Symbols line before library line: '%s'", line)
+		case strings.HasPrefix(line, "|"):
+			current.Dependencies = append(current.Dependencies, strings.TrimSpace(line[1:]))
+		case strings.HasPrefix(line, "*"):
+			fields := strings.SplitN(line[1:], ":", 2)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("Malformed symbols field: '%s'", line)
+			}
+			current.Fields[strings.TrimSpace(fields[0])] = strings.TrimSpace(fields[1])
+		default:
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("Malformed symbol: '%s'", line)
+			}
+			symbol := Symbol{Name: fields[0], MinVersion: fields[1]}
+			if len(fields) > 2 {
+				id, err := strconv.Atoi(fields[2])
+				if err != nil {
+					return nil, fmt.Errorf("Malformed symbol dependency id: '%s'", line)
+				}
+				symbol.DependencyID = id
+			}
+			current.Symbols = append(current.Symbols, symbol)
+		}
+	}
+	return ret, nil
+}
+
+// }}}
+
+// Triggers {{{
+
+// A Trigger is an entry in the triggers control member, such as
+// "interest-noawait /usr/share/icons". See deb-triggers(5).
+type Trigger struct {
+	Directive string
+	Name      string
+}
+
+// Parse the triggers control member.
+func (c *ControlFiles) GetTriggers() ([]Trigger, error) {
+	ret := []Trigger{}
+	for _, line := range controlFileLines(c.Members["triggers"]) {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Malformed triggers line: '%s'", line)
+		}
+		ret = append(ret, Trigger{Directive: fields[0], Name: fields[1]})
+	}
+	return ret, nil
+}
+
+// }}}
+
+// Templates {{{
+
+// Parse the debconf templates control member into one Paragraph per
+// template.
+func (c *ControlFiles) GetTemplates() ([]control.Paragraph, error) {
+	data, ok := c.Members["templates"]
+	if !ok {
+		return []control.Paragraph{}, nil
+	}
+	reader, err := control.NewParagraphReader(bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, err
+	}
+	return reader.All()
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,129 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bytes"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+// Test Control Members {{{
+const testShlibs = `libfoo 1 libfoo1 (>= 1.2)
+udeb: libfoo 1 libfoo1-udeb (>= 1.2)
+`
+
+const testSymbols = `libfoo.so.1 libfoo1 #MINVER#
+| libfoo-compat #MINVER#
+* Build-Depends-Package: libfoo-dev
+ foo_init@Base 1.0
+ foo_frobnicate@Base 1.2 1
+`
+
+const testTriggers = `# Trigger the icon cache
+interest-noawait /usr/share/icons/hicolor
+activate-noawait ldconfig
+`
+
+const testTemplates = `Template: foo/enable
+Type: boolean
+Default: true
+Description: Enable foo?
+ Whether to enable foo.
+
+Template: foo/name
+Type: string
+Description: Name for foo:
+`
+
+// }}}
+
+func TestControlFiles(t *testing.T) {
+	builder := newTestBuilder(t, "gz")
+	builder.ControlMembers["shlibs"] = []byte(testShlibs)
+	builder.ControlMembers["symbols"] = []byte(testSymbols)
+	builder.ControlMembers["triggers"] = []byte(testTriggers)
+	builder.ControlMembers["templates"] = []byte(testTemplates)
+	builder.ControlMembers["config"] = []byte("#!/bin/sh\n")
+	builder.ControlMembers["clilibs"] = []byte("")
+
+	out := bytes.Buffer{}
+	isok(t, builder.Write(&out))
+	debFile, err := deb.Load(bytes.NewReader(out.Bytes()), "hello.deb")
+	isok(t, err)
+	defer debFile.Close()
+	files := debFile.ControlFiles
+
+	scripts := files.MaintainerScripts()
+	assert(t, len(scripts) == 2)
+	assert(t, string(scripts["postinst"]) == "#!/bin/sh\nexit 0\n")
+	other := files.Other()
+	assert(t, len(other) == 1 && other[0] == "clilibs")
+
+	conffiles := files.GetConffiles()
+	assert(t, len(conffiles) == 1)
+	assert(t, conffiles[0].Path == "/etc/hello.conf")
+	assert(t, len(conffiles[0].Flags) == 0)
+
+	md5sums, err := files.GetMD5Sums()
+	isok(t, err)
+	assert(t, len(md5sums) == 2)
+	assert(t, md5sums[0].Path == "etc/hello.conf")
+	assert(t, len(md5sums[0].Hash) == 32)
+
+	shlibs, err := files.GetShlibs()
+	isok(t, err)
+	assert(t, len(shlibs) == 2)
+	assert(t, shlibs[0].Library == "libfoo" && shlibs[0].Version == "1")
+	assert(t, shlibs[0].Dependency.Relations[0].Possibilities[0].Name == "libfoo1")
+	assert(t, shlibs[1].Type == "udeb")
+
+	symbols, err := files.GetSymbols()
+	isok(t, err)
+	assert(t, len(symbols) == 1)
+	assert(t, symbols[0].Library == "libfoo.so.1")
+	assert(t, len(symbols[0].Dependencies) == 2)
+	assert(t, symbols[0].Dependencies[1] == "libfoo-compat #MINVER#")
+	assert(t, symbols[0].Fields["Build-Depends-Package"] == "libfoo-dev")
+	assert(t, len(symbols[0].Symbols) == 2)
+	assert(t, symbols[0].Symbols[1].Name == "foo_frobnicate@Base")
+	assert(t, symbols[0].Symbols[1].MinVersion == "1.2")
+	assert(t, symbols[0].Symbols[1].DependencyID == 1)
+
+	triggers, err := files.GetTriggers()
+	isok(t, err)
+	assert(t, len(triggers) == 2)
+	assert(t, triggers[0].Directive == "interest-noawait")
+	assert(t, triggers[1].Name == "ldconfig")
+
+	templates, err := files.GetTemplates()
+	isok(t, err)
+	assert(t, len(templates) == 2)
+	assert(t, templates[0].Values["Template"] == "foo/enable")
+	assert(t, templates[1].Values["Type"] == "string")
+}
+
+// vim: foldmethod=marker
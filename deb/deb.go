@@ -23,10 +23,11 @@ package deb // import "pault.ag/go/debian/deb"
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
-	"path"
+	"path/filepath"
 	"strings"
 
 	"pault.ag/go/debian/control"
@@ -42,23 +43,34 @@ import (
 type Control struct {
 	control.Paragraph
 
-	Package       string `required:"true"`
-	Source        string
-	Version       version.Version `required:"true"`
-	Architecture  dependency.Arch `required:"true"`
-	Maintainer    string
-	InstalledSize int    `control:"Installed-Size"`
-	MultiArch     string `control:"Multi-Arch"`
-	Depends       dependency.Dependency
-	Recommends    dependency.Dependency
-	Suggests      dependency.Dependency
-	Breaks        dependency.Dependency
-	Replaces      dependency.Dependency
-	BuiltUsing    dependency.Dependency `control:"Built-Using"`
-	Section       string
-	Priority      string
-	Homepage      string
-	Description   string
+	Package            string `required:"true"`
+	Source             string
+	Version            version.Version `required:"true"`
+	Architecture       dependency.Arch `required:"true"`
+	Maintainer         string
+	OriginalMaintainer string                `control:"Original-Maintainer"`
+	InstalledSize      int                   `control:"Installed-Size" omitempty:"true"`
+	MultiArch          string                `control:"Multi-Arch"`
+	Essential          bool                  `omitempty:"true"`
+	Protected          bool                  `omitempty:"true"`
+	BuildEssential     bool                  `control:"Build-Essential" omitempty:"true"`
+	PreDepends         dependency.Dependency `control:"Pre-Depends"`
+	Depends            dependency.Dependency
+	Recommends         dependency.Dependency
+	Suggests           dependency.Dependency
+	Enhances           dependency.Dependency
+	Breaks             dependency.Dependency
+	Conflicts          dependency.Dependency
+	Provides           dependency.Dependency
+	Replaces           dependency.Dependency
+	BuiltUsing         dependency.Dependency `control:"Built-Using"`
+	StaticBuiltUsing   dependency.Dependency `control:"Static-Built-Using"`
+	BuiltForProfiles   []string              `control:"Built-For-Profiles" delim:" "`
+	Section            string
+	Priority           string
+	Homepage           string
+	Description        string
+	Conffiles          []Conffile `delim:"\n" strip:"\n\r\t " multiline:"true"`
 }
 
 func (c Control) SourceName() string {
@@ -75,15 +87,17 @@ func (c Control) SourceName() string {
 // Container struct to encapsulate a `.deb` file on disk. This contains
 // information about what exactly we're looking at. When loaded. information
 // regarding the Control file is read from the control section of the .deb,
-// and Unmarshaled into the `Control` member of the Struct.
+// and Unmarshaled into the `Control` member of the Struct. The rest of the
+// control section is available in the `ControlFiles` member.
 type Deb struct {
-	Control    Control
-	Path       string
-	Data       *tar.Reader
-	Closer     io.Closer
-	ControlExt string
-	DataExt    string
-	ArContent  map[string]*ArEntry
+	Control      Control
+	ControlFiles ControlFiles
+	Path         string
+	Data         *tar.Reader
+	Closer       io.Closer
+	ControlExt   string
+	DataExt      string
+	ArContent    map[string]*ArEntry
 }
 
 func (deb *Deb) Close() error {
@@ -162,6 +176,68 @@ func LoadFile(path string) (*Deb, Closer, error) {
 
 // }}}
 
+// LoadStream {{{
+
+// Given a reader that can't seek, such as an HTTP request body or a pipe,
+// create a deb.Deb object by reading the `.deb` sequentially, in a single
+// pass. The debian-binary and control members are read into memory, and
+// the Data member streams data.tar straight from `in`.
+//
+// Since the stream can't be rewound, Deb.Data may only be read once, and
+// ArContent only holds the members before data.tar. Any members following
+// data.tar (such as debsig signatures) are left unread in `in`.
+// It is the caller's responsibility to call Close() when done.
+func LoadStream(in io.Reader, pathname string) (*Deb, error) {
+	ar, err := NewArReader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := Deb{Path: pathname, ArContent: map[string]*ArEntry{}}
+	for {
+		member, err := ar.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("Missing or out of order .deb member 'data'")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(member.Name, "data.") {
+			if _, ok := ret.ArContent["debian-binary"]; !ok {
+				return nil, fmt.Errorf("Archive contains no binary version member!")
+			}
+			if err := loadDeb2Control(ret.ArContent, &ret); err != nil {
+				return nil, err
+			}
+			if !member.IsTarfile() {
+				return nil, fmt.Errorf("%s appears to not be a tarfile", member.Name)
+			}
+			readCloser, err := DecompressorFor(filepath.Ext(member.Name))(ar)
+			if err != nil {
+				return nil, err
+			}
+			ret.DataExt = member.Name[5:len(member.Name)]
+			ret.Data = tar.NewReader(readCloser)
+			ret.Closer = readCloser
+			return &ret, nil
+		}
+
+		data, err := io.ReadAll(ar)
+		if err != nil {
+			return nil, err
+		}
+		member.Data = io.NewSectionReader(bytes.NewReader(data), 0, member.Size)
+		ret.ArContent[member.Name] = member
+
+		if member.Name == "debian-binary" && string(data) != "2.0\n" {
+			return nil, fmt.Errorf("Unknown binary version: '%s'", string(data))
+		}
+	}
+}
+
+// }}}
+
 // Debian .deb Loader Internals {{{
 
 // Top-level .deb loader dispatch on Version {{{
@@ -232,22 +308,13 @@ func loadDeb2Control(archive map[string]*ArEntry, deb *Deb) error {
 				return err
 			}
 			deb.ControlExt = member.Name[8:len(member.Name)]
-			for {
-				member, err := archive.Next()
-				if err != nil {
-					closer.Close()
-					return err
-				}
-				if path.Clean(member.Name) == "control" {
-					err1 := control.Unmarshal(&deb.Control, archive)
-					err2 := closer.Close()
-					if err1 != nil {
-						return err1
-					}
-					return err2
-				}
-			}
+			controlFile, controlFiles, err := readControlTar(archive)
 			closer.Close()
+			if err != nil {
+				return err
+			}
+			deb.ControlFiles = *controlFiles
+			return control.Unmarshal(&deb.Control, bytes.NewReader(controlFile))
 		}
 	}
 	return fmt.Errorf("Missing or out of order .deb member 'control'")
@@ -0,0 +1,64 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+func TestLoadStream(t *testing.T) {
+	out := bytes.Buffer{}
+	isok(t, newTestBuilder(t, "zst").Write(&out))
+	want := sha256.Sum256(out.Bytes())
+
+	/* Hash the .deb in the same pass as reading it */
+	hash := sha256.New()
+	in := io.TeeReader(iotest.OneByteReader(bytes.NewReader(out.Bytes())), hash)
+
+	debFile, err := deb.LoadStream(in, "hello.deb")
+	isok(t, err)
+	assert(t, debFile.Control.Package == "hello")
+	assert(t, debFile.DataExt == "tar.zst")
+	_, ok := debFile.ControlFiles.Get("postinst")
+	assert(t, ok)
+	isok(t, debFile.VerifyMD5Sums())
+	isok(t, debFile.Close())
+
+	_, err = io.Copy(io.Discard, in)
+	isok(t, err)
+	assert(t, bytes.Equal(hash.Sum(nil), want[:]))
+
+	_, err = deb.LoadStream(strings.NewReader("!<arch>\n"), "empty.deb")
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
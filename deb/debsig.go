@@ -0,0 +1,334 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Sign {{{
+
+// Write the `.deb` out to `out`, with an ASCII armored detached signature
+// of type `sigType` (one of SigTypeArchive, SigTypeMaint or SigTypeOrigin)
+// made by `signer` appended as the `_gpg<sigType>` member, in the same way
+// as debsigs(1). Any existing signature of the same type is replaced, and
+// other signatures are kept.
+//
+// The Deb must have been loaded with Load or LoadFile, since every member
+// needs to be read again.
+func (deb *Deb) Sign(out io.Writer, signer *openpgp.Entity, sigType string) error {
+	members, err := deb.orderedMembers()
+	if err != nil {
+		return err
+	}
+
+	signedData := []io.Reader{}
+	for _, member := range members[:3] {
+		signedData = append(signedData, io.NewSectionReader(member.Data, 0, member.Size))
+	}
+	/* Use the timestamp of the existing members for both the signature and
+	 * its member, so signing the same .deb twice gives the same output. */
+	timestamp := time.Unix(members[0].Timestamp, 0)
+	config := packet.Config{Time: func() time.Time { return timestamp }}
+
+	signature := bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(
+		&signature, signer, io.MultiReader(signedData...), &config,
+	); err != nil {
+		return err
+	}
+	signature.WriteString("\n")
+
+	ar, err := NewArWriter(out)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.Name == "_gpg"+sigType {
+			continue
+		}
+		if err := ar.WriteEntry(*member, io.NewSectionReader(member.Data, 0, member.Size)); err != nil {
+			return err
+		}
+	}
+	return ar.WriteBytes(ArEntry{
+		Name:      "_gpg" + sigType,
+		Timestamp: timestamp.Unix(),
+		FileMode:  "100644",
+	}, signature.Bytes())
+}
+
+// Sign the `.deb` at `path` (see Deb.Sign), and replace it with the signed
+// `.deb`, keeping the permissions of the original file.
+func SignDebFile(path string, signer *openpgp.Entity, sigType string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	debFile, closer, err := LoadFile(path)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	fd, err := os.CreateTemp(filepath.Dir(path), ".signing-*.deb")
+	if err != nil {
+		return err
+	}
+	if err := writeSignedDeb(fd, debFile, signer, sigType, info.Mode().Perm()); err != nil {
+		os.Remove(fd.Name())
+		return err
+	}
+	if err := os.Rename(fd.Name(), path); err != nil {
+		os.Remove(fd.Name())
+		return err
+	}
+	return nil
+}
+
+// Write the signed `.deb` to the (temporary) file `fd`, with permissions
+// `mode`, and close it.
+func writeSignedDeb(fd *os.File, debFile *Deb, signer *openpgp.Entity, sigType string, mode os.FileMode) error {
+	if err := debFile.Sign(fd, signer, sigType); err != nil {
+		fd.Close()
+		return err
+	}
+	/* CreateTemp creates the file 0600 */
+	if err := fd.Chmod(mode); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// Return the members of the `.deb` in the order they need to be written
+// out in; debian-binary, control.tar, data.tar, followed by any other
+// members (such as signatures) in sorted order.
+func (deb *Deb) orderedMembers() ([]*ArEntry, error) {
+	var binaryFlag, control, data *ArEntry
+	others := []*ArEntry{}
+	for _, member := range deb.ArContent {
+		switch {
+		case member.Name == "debian-binary":
+			binaryFlag = member
+		case strings.HasPrefix(member.Name, "control."):
+			control = member
+		case strings.HasPrefix(member.Name, "data."):
+			data = member
+		default:
+			others = append(others, member)
+		}
+	}
+	if binaryFlag == nil || control == nil || data == nil {
+		return nil, fmt.Errorf("unable to find signed data")
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Name < others[j].Name
+	})
+	return append([]*ArEntry{binaryFlag, control, data}, others...), nil
+}
+
+// }}}
+
+// Policy {{{
+
+// A DebsigPolicy is a debsig-verify(1) policy file, which describes which
+// signatures a `.deb` from a given origin must carry, and which keyrings
+// they must be verified against.
+type DebsigPolicy struct {
+	XMLName      xml.Name     `xml:"Policy"`
+	Origin       DebsigOrigin `xml:"Origin"`
+	Selection    DebsigRules  `xml:"Selection"`
+	Verification DebsigRules  `xml:"Verification"`
+}
+
+// The origin of the `.deb`s that a DebsigPolicy applies to. The ID is the
+// key ID of the origin's signing key.
+type DebsigOrigin struct {
+	Name        string `xml:"Name,attr"`
+	ID          string `xml:"id,attr"`
+	Description string `xml:"Description,attr"`
+}
+
+// A set of rules, all of which must match. Every Required signature must
+// be present and valid, no Reject signature may be present, and at least
+// MinOptional of the Optional signatures must be present and valid.
+type DebsigRules struct {
+	MinOptional int           `xml:"MinOptional,attr"`
+	Required    []DebsigMatch `xml:"Required"`
+	Optional    []DebsigMatch `xml:"Optional"`
+	Reject      []DebsigMatch `xml:"Reject"`
+}
+
+// A rule matching a signature of the given Type, which must verify against
+// the keyring File, and (if set) be made by the key with the given ID.
+type DebsigMatch struct {
+	Type string `xml:"Type,attr"`
+	File string `xml:"File,attr"`
+	ID   string `xml:"id,attr"`
+}
+
+// Parse a debsig-verify policy file from an io.Reader.
+func ParseDebsigPolicy(in io.Reader) (*DebsigPolicy, error) {
+	ret := DebsigPolicy{}
+	if err := xml.NewDecoder(in).Decode(&ret); err != nil {
+		return nil, err
+	}
+	if ret.Origin.ID == "" {
+		return nil, fmt.Errorf("Policy has no Origin id")
+	}
+	return &ret, nil
+}
+
+// Parse the debsig-verify policy file at `path`.
+func ParseDebsigPolicyFile(path string) (*DebsigPolicy, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return ParseDebsigPolicy(fd)
+}
+
+// Check to see if the `.deb` matches the Selection rules of the policy,
+// meaning that the policy applies to it. Keyring files named by the
+// policy are loaded from `keyringDir` (such as
+// "/usr/share/debsig/keyrings/<origin id>").
+func (deb *Deb) SelectsDebsigPolicy(policy *DebsigPolicy, keyringDir string) error {
+	return deb.checkDebsigRules(policy.Selection, keyringDir)
+}
+
+// Check the `.deb` against the Selection and Verification rules of the
+// policy, returning an error if the policy doesn't apply, or if the
+// signatures of the `.deb` don't satisfy it. Keyring files named by the
+// policy are loaded from `keyringDir`.
+func (deb *Deb) CheckDebsigPolicy(policy *DebsigPolicy, keyringDir string) error {
+	if err := deb.SelectsDebsigPolicy(policy, keyringDir); err != nil {
+		return fmt.Errorf("Policy for %s doesn't apply: %w", policy.Origin.Name, err)
+	}
+	if err := deb.checkDebsigRules(policy.Verification, keyringDir); err != nil {
+		return fmt.Errorf("Policy for %s failed: %w", policy.Origin.Name, err)
+	}
+	return nil
+}
+
+// Check the `.deb` in the same way as debsig-verify(1); every policy in
+// `policiesDir` (laid out as "<origin id>/<name>.pol") is tried in turn,
+// with keyrings from "<keyringsDir>/<origin id>/", and the `.deb` is
+// verified against the first policy whose Selection rules match it.
+//
+// The matching policy is returned if the `.deb` passes verification.
+func (deb *Deb) CheckDebsigPolicies(policiesDir, keyringsDir string) (*DebsigPolicy, error) {
+	paths, err := filepath.Glob(filepath.Join(policiesDir, "*", "*.pol"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		policy, err := ParseDebsigPolicyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keyringDir := filepath.Join(keyringsDir, policy.Origin.ID)
+		if deb.SelectsDebsigPolicy(policy, keyringDir) != nil {
+			continue
+		}
+		if err := deb.checkDebsigRules(policy.Verification, keyringDir); err != nil {
+			return nil, fmt.Errorf("Policy for %s failed: %w", policy.Origin.Name, err)
+		}
+		return policy, nil
+	}
+	return nil, fmt.Errorf("No applicable debsig policy found")
+}
+
+// Check the `.deb` against a set of rules.
+func (deb *Deb) checkDebsigRules(rules DebsigRules, keyringDir string) error {
+	for _, match := range rules.Reject {
+		if _, ok := deb.ArContent["_gpg"+match.Type]; ok {
+			return fmt.Errorf("Rejected signature of type %s is present", match.Type)
+		}
+	}
+	for _, match := range rules.Required {
+		if err := deb.checkDebsigMatch(match, keyringDir); err != nil {
+			return err
+		}
+	}
+	valid := 0
+	for _, match := range rules.Optional {
+		if deb.checkDebsigMatch(match, keyringDir) == nil {
+			valid++
+		}
+	}
+	if valid < rules.MinOptional {
+		return fmt.Errorf(
+			"Only %d optional signatures are valid, but %d are required",
+			valid, rules.MinOptional,
+		)
+	}
+	return nil
+}
+
+// Check that the signature for a single rule is present and valid.
+func (deb *Deb) checkDebsigMatch(match DebsigMatch, keyringDir string) error {
+	keyring, err := loadDebsigKeyring(filepath.Join(keyringDir, match.File))
+	if err != nil {
+		return err
+	}
+	signer, err := deb.CheckDebsig(keyring, match.Type)
+	if err != nil {
+		return err
+	}
+	if match.ID != "" && !strings.EqualFold(signer.PrimaryKey.KeyIdString(), match.ID) {
+		return fmt.Errorf(
+			"Signature of type %s was made by %s, not %s",
+			match.Type, signer.PrimaryKey.KeyIdString(), match.ID,
+		)
+	}
+	return nil
+}
+
+// Load a keyring, which may be binary or ASCII armored.
+func loadDebsigKeyring(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte(armorHeader)) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// }}}
+
+// vim: foldmethod=marker
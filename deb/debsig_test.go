@@ -0,0 +1,207 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+// Test Policy {{{
+const testPolicy = `<?xml version="1.0"?>
+<!DOCTYPE Policy SYSTEM "https://www.debian.org/debsig/1.0/policy.dtd">
+<Policy xmlns="https://www.debian.org/debsig/1.0/">
+  <Origin Name="test" id="FAD46790DE88C7E2" Description="Debsig testing"/>
+  <Selection>
+    <Required Type="origin" File="pubring.gpg" id="FAD46790DE88C7E2"/>
+  </Selection>
+  <Verification MinOptional="1">
+    <Required Type="origin" File="pubring.gpg" id="FAD46790DE88C7E2"/>
+    <Optional Type="maint" File="pubring.gpg"/>
+    <Reject Type="archive"/>
+  </Verification>
+</Policy>
+`
+
+// }}}
+
+func loadTestKeyring(t *testing.T, name string) openpgp.EntityList {
+	fd, err := os.Open(filepath.Join("testdata", "keyrings", "FAD46790DE88C7E2", name))
+	isok(t, err)
+	defer fd.Close()
+	keyring, err := openpgp.ReadKeyRing(fd)
+	isok(t, err)
+	return keyring
+}
+
+func signTestDeb(t *testing.T, debFile *deb.Deb, sigType string) *deb.Deb {
+	secring := loadTestKeyring(t, "secring.gpg")
+	out := bytes.Buffer{}
+	isok(t, debFile.Sign(&out, secring[0], sigType))
+	signed, err := deb.Load(bytes.NewReader(out.Bytes()), "hello.deb")
+	isok(t, err)
+	return signed
+}
+
+func TestSign(t *testing.T) {
+	out := bytes.Buffer{}
+	isok(t, newTestBuilder(t, "gz").Write(&out))
+	debFile, err := deb.Load(bytes.NewReader(out.Bytes()), "hello.deb")
+	isok(t, err)
+
+	pubring := loadTestKeyring(t, "pubring.gpg")
+
+	signed := signTestDeb(t, debFile, deb.SigTypeOrigin)
+	signer, err := signed.CheckDebsig(pubring, deb.SigTypeOrigin)
+	isok(t, err)
+	assert(t, signer.PrimaryKey.KeyIdString() == "FAD46790DE88C7E2")
+	_, err = signed.CheckDebsig(pubring, deb.SigTypeMaint)
+	notok(t, err)
+
+	/* Signing again keeps the existing signature */
+	signed = signTestDeb(t, signed, deb.SigTypeMaint)
+	_, err = signed.CheckDebsig(pubring, deb.SigTypeOrigin)
+	isok(t, err)
+	_, err = signed.CheckDebsig(pubring, deb.SigTypeMaint)
+	isok(t, err)
+	assert(t, signed.Control.Package == "hello")
+	isok(t, signed.VerifyMD5Sums())
+}
+
+func TestSignReproducible(t *testing.T) {
+	builder := newTestBuilder(t, "gz")
+	builder.ModTime = time.Unix(1361157466, 0)
+	out := bytes.Buffer{}
+	isok(t, builder.Write(&out))
+	debFile, err := deb.Load(bytes.NewReader(out.Bytes()), "hello.deb")
+	isok(t, err)
+
+	secring := loadTestKeyring(t, "secring.gpg")
+	first := bytes.Buffer{}
+	isok(t, debFile.Sign(&first, secring[0], deb.SigTypeOrigin))
+	second := bytes.Buffer{}
+	isok(t, debFile.Sign(&second, secring[0], deb.SigTypeOrigin))
+	assert(t, bytes.Equal(first.Bytes(), second.Bytes()))
+
+	/* The signature member reuses the timestamp of the others */
+	ar, err := deb.LoadAr(bytes.NewReader(first.Bytes()))
+	isok(t, err)
+	for {
+		entry, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		isok(t, err)
+		assert(t, entry.Timestamp == 1361157466)
+	}
+}
+
+func TestSignDebFile(t *testing.T) {
+	out := bytes.Buffer{}
+	isok(t, newTestBuilder(t, "gz").Write(&out))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.deb")
+	isok(t, os.WriteFile(path, out.Bytes(), 0644))
+	isok(t, os.Chmod(path, 0644))
+
+	secring := loadTestKeyring(t, "secring.gpg")
+	isok(t, deb.SignDebFile(path, secring[0], deb.SigTypeOrigin))
+
+	info, err := os.Stat(path)
+	isok(t, err)
+	assert(t, info.Mode().Perm() == 0644)
+
+	/* Only the signed .deb is left behind */
+	entries, err := os.ReadDir(dir)
+	isok(t, err)
+	assert(t, len(entries) == 1)
+
+	pubring := loadTestKeyring(t, "pubring.gpg")
+	signed, closer, err := deb.LoadFile(path)
+	isok(t, err)
+	defer closer()
+	_, err = signed.CheckDebsig(pubring, deb.SigTypeOrigin)
+	isok(t, err)
+
+	/* Failures don't leave the temporary file behind either */
+	notok(t, deb.SignDebFile(path, pubring[0], deb.SigTypeMaint))
+	entries, err = os.ReadDir(dir)
+	isok(t, err)
+	assert(t, len(entries) == 1)
+}
+
+func TestDebsigPolicy(t *testing.T) {
+	policy, err := deb.ParseDebsigPolicy(strings.NewReader(testPolicy))
+	isok(t, err)
+	assert(t, policy.Origin.ID == "FAD46790DE88C7E2")
+	assert(t, policy.Verification.MinOptional == 1)
+	assert(t, len(policy.Verification.Required) == 1)
+	assert(t, policy.Verification.Required[0].File == "pubring.gpg")
+	assert(t, len(policy.Verification.Reject) == 1)
+
+	out := bytes.Buffer{}
+	isok(t, newTestBuilder(t, "gz").Write(&out))
+	unsigned, err := deb.Load(bytes.NewReader(out.Bytes()), "hello.deb")
+	isok(t, err)
+	origin := signTestDeb(t, unsigned, deb.SigTypeOrigin)
+	maint := signTestDeb(t, origin, deb.SigTypeMaint)
+	archive := signTestDeb(t, maint, deb.SigTypeArchive)
+
+	keyringDir := filepath.Join("testdata", "keyrings", "FAD46790DE88C7E2")
+
+	/* The policy doesn't apply to unsigned packages */
+	notok(t, unsigned.SelectsDebsigPolicy(policy, keyringDir))
+	isok(t, origin.SelectsDebsigPolicy(policy, keyringDir))
+
+	/* One optional signature is required, and archive ones are rejected */
+	notok(t, origin.CheckDebsigPolicy(policy, keyringDir))
+	isok(t, maint.CheckDebsigPolicy(policy, keyringDir))
+	notok(t, archive.CheckDebsigPolicy(policy, keyringDir))
+
+	policiesDir := t.TempDir()
+	isok(t, os.MkdirAll(filepath.Join(policiesDir, "FAD46790DE88C7E2"), 0755))
+	isok(t, os.WriteFile(
+		filepath.Join(policiesDir, "FAD46790DE88C7E2", "test.pol"),
+		[]byte(testPolicy), 0644,
+	))
+	keyringsDir := filepath.Join("testdata", "keyrings")
+
+	matched, err := maint.CheckDebsigPolicies(policiesDir, keyringsDir)
+	isok(t, err)
+	assert(t, matched.Origin.Name == "test")
+	_, err = unsigned.CheckDebsigPolicies(policiesDir, keyringsDir)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,304 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"archive/tar"
+)
+
+// Extract {{{
+
+// ExtractOptions controls how Deb.Extract writes files out to disk.
+type ExtractOptions struct {
+	// Don't change the ownership of any extracted files (which requires
+	// root), and don't set the setuid, setgid or sticky bits. The
+	// ownership and full mode of every file is still returned in the
+	// manifest from Extract.
+	Rootless bool
+}
+
+// Ownership records the owner and mode of a file from data.tar. The Path
+// is relative to the root of the filesystem, without a leading slash.
+type Ownership struct {
+	Path  string
+	Uid   int
+	Gid   int
+	Uname string
+	Gname string
+	Mode  os.FileMode
+}
+
+// Extract the contents of data.tar into the directory `dest`, recreating
+// files, directories, symlinks and hardlinks, along with their permissions
+// and modification times (other than for symlinks).
+//
+// Entries which would be written outside of `dest`, either with `..`
+// path components, or by way of a symlink in one of their parent
+// directories, are refused with an error. Symlinks themselves may point
+// anywhere, but are never followed while extracting.
+//
+// A manifest of the ownership and mode of every entry is returned, in the
+// order they appear in data.tar.
+func (deb *Deb) Extract(dest string, options ExtractOptions) ([]Ownership, error) {
+	data, closer, err := deb.openData()
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	return extractTar(data, dest, options, 0)
+}
+
+// }}}
+
+// Extract Internals {{{
+
+// Extract every entry of `data` into `dest`, after removing `strip`
+// leading components from their names, as is done by Deb.Extract.
+func extractTar(data *tar.Reader, dest string, options ExtractOptions, strip int) ([]Ownership, error) {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+
+	manifest := []Ownership{}
+	directories := []*tar.Header{}
+
+	for {
+		header, err := data.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := extractName(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		name = stripComponents(name, strip)
+		if name == "." {
+			continue
+		}
+		target, err := extractPath(dest, name)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := header.FileInfo().Mode()
+		manifest = append(manifest, Ownership{
+			Path:  name,
+			Uid:   header.Uid,
+			Gid:   header.Gid,
+			Uname: header.Uname,
+			Gname: header.Gname,
+			Mode:  mode,
+		})
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+				if err := os.Remove(target); err != nil {
+					return nil, err
+				}
+			}
+			/* Directories are made writable until everything is written
+			 * out, and then get their real mode and mtime at the end. */
+			if err := os.Mkdir(target, 0755); err != nil && !os.IsExist(err) {
+				return nil, err
+			}
+			directories = append(directories, header)
+			continue
+		case tar.TypeReg:
+			if err := removeExisting(target); err != nil {
+				return nil, err
+			}
+			fd, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := io.Copy(fd, data); err != nil {
+				fd.Close()
+				return nil, err
+			}
+			if err := fd.Close(); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink:
+			if err := removeExisting(target); err != nil {
+				return nil, err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return nil, err
+			}
+		case tar.TypeLink:
+			linkName, err := extractName(header.Linkname)
+			if err != nil {
+				return nil, err
+			}
+			linkName = stripComponents(linkName, strip)
+			source, err := extractPath(dest, linkName)
+			if err != nil {
+				return nil, err
+			}
+			if info, err := os.Lstat(source); err != nil || !info.Mode().IsRegular() {
+				return nil, fmt.Errorf("Hardlink '%s' points to '%s', which isn't a regular file", name, linkName)
+			}
+			if err := removeExisting(target); err != nil {
+				return nil, err
+			}
+			if err := os.Link(source, target); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			return nil, fmt.Errorf("Unsupported type for '%s' in tarball", name)
+		}
+
+		if header.Typeflag == tar.TypeSymlink {
+			if !options.Rootless {
+				if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err := setAttributes(target, header, options); err != nil {
+			return nil, err
+		}
+	}
+
+	/* Deepest directories first, so that their mtimes aren't changed by
+	 * setting the attributes of their children. */
+	sort.SliceStable(directories, func(i, j int) bool {
+		return len(directories[i].Name) > len(directories[j].Name)
+	})
+	for _, header := range directories {
+		name, _ := extractName(header.Name)
+		name = stripComponents(name, strip)
+		target, err := extractPath(dest, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := setAttributes(target, header, options); err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// Clean up the name of a data.tar entry, returning the path relative to
+// the root of the filesystem (such as "usr/bin/hello"), or an error if
+// the entry would escape it.
+func extractName(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimLeft(name, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("Refusing to extract '%s' outside of the destination", name)
+	}
+	return cleaned, nil
+}
+
+// Remove the first `strip` components from an (already cleaned) entry
+// name, returning "." if there's nothing left.
+func stripComponents(name string, strip int) string {
+	parts := strings.SplitN(name, "/", strip+1)
+	if len(parts) <= strip {
+		return "."
+	}
+	return parts[strip]
+}
+
+// Return the path on disk for the (already cleaned) entry `name`, making
+// sure that none of its parent directories inside `dest` is a symlink,
+// since that could be used to write outside of `dest`. Any missing parent
+// directories are created.
+func extractPath(dest, name string) (string, error) {
+	current := dest
+	parts := strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(current, 0755); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("Refusing to extract '%s' through the symlink '%s'", name, current)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("Can't extract '%s', since '%s' isn't a directory", name, current)
+		}
+	}
+	return filepath.Join(dest, filepath.FromSlash(name)), nil
+}
+
+// Remove whatever is at `target` (without following symlinks), unless it's
+// a directory.
+func removeExisting(target string) error {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("Can't replace the directory '%s'", target)
+	}
+	return os.Remove(target)
+}
+
+// Set the owner, mode and mtime of an extracted file or directory.
+func setAttributes(target string, header *tar.Header, options ExtractOptions) error {
+	mode := header.FileInfo().Mode()
+	if options.Rootless {
+		mode = mode.Perm()
+	} else {
+		if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+			return err
+		}
+		mode = mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+	if err := os.Chmod(target, mode); err != nil {
+		return err
+	}
+	return os.Chtimes(target, time.Now(), header.ModTime)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,143 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+// Create a .deb with an uncompressed data.tar containing the given entries,
+// which isn't possible with the Builder.
+func newRawDeb(t *testing.T, entries []*tar.Header) *deb.Deb {
+	return newRawDebWithContents(t, entries, map[string]string{})
+}
+
+// Create a .deb in the same way as newRawDeb, setting the contents of any
+// regular files in data.tar from `contents`, keyed by entry name.
+func newRawDebWithContents(t *testing.T, entries []*tar.Header, contents map[string]string) *deb.Deb {
+	tarball := func(headers []*tar.Header, contents map[string]string) []byte {
+		out := bytes.Buffer{}
+		tw := tar.NewWriter(&out)
+		for _, header := range headers {
+			header.Size = int64(len(contents[header.Name]))
+			isok(t, tw.WriteHeader(header))
+			_, err := tw.Write([]byte(contents[header.Name]))
+			isok(t, err)
+		}
+		isok(t, tw.Close())
+		return out.Bytes()
+	}
+
+	controlTar := tarball(
+		[]*tar.Header{{Name: "./control", Typeflag: tar.TypeReg, Mode: 0644}},
+		map[string]string{"./control": "Package: evil\nVersion: 1.0\nArchitecture: all\n"},
+	)
+	dataTar := tarball(entries, contents)
+
+	out := bytes.Buffer{}
+	writer, err := deb.NewArWriter(&out)
+	isok(t, err)
+	isok(t, writer.WriteBytes(deb.ArEntry{Name: "debian-binary"}, []byte("2.0\n")))
+	isok(t, writer.WriteBytes(deb.ArEntry{Name: "control.tar"}, controlTar))
+	isok(t, writer.WriteBytes(deb.ArEntry{Name: "data.tar"}, dataTar))
+
+	debFile, err := deb.Load(bytes.NewReader(out.Bytes()), "evil.deb")
+	isok(t, err)
+	return debFile
+}
+
+func TestExtract(t *testing.T) {
+	out := bytes.Buffer{}
+	isok(t, newTestBuilder(t, "gz").Write(&out))
+	debFile, err := deb.Load(bytes.NewReader(out.Bytes()), "hello.deb")
+	isok(t, err)
+	defer debFile.Close()
+
+	dest := t.TempDir()
+	manifest, err := debFile.Extract(dest, deb.ExtractOptions{Rootless: true})
+	isok(t, err)
+	assert(t, len(manifest) == 5)
+	assert(t, manifest[0].Path == "etc")
+	assert(t, manifest[0].Uname == "root")
+
+	content, err := os.ReadFile(filepath.Join(dest, "usr", "bin", "hello"))
+	isok(t, err)
+	assert(t, string(content) == "#!/bin/sh\necho hello\n")
+
+	info, err := os.Stat(filepath.Join(dest, "usr", "bin", "hello"))
+	isok(t, err)
+	assert(t, info.Mode().Perm() == 0755)
+	assert(t, info.ModTime().Unix() == 1700000000)
+
+	info, err = os.Stat(filepath.Join(dest, "usr"))
+	isok(t, err)
+	assert(t, info.IsDir())
+	assert(t, info.ModTime().Unix() == 1700000000)
+}
+
+func TestExtractTraversal(t *testing.T) {
+	outside := t.TempDir()
+
+	for _, entries := range [][]*tar.Header{
+		{{Name: "./../evil", Typeflag: tar.TypeReg, Mode: 0644}},
+		{{Name: "./usr/../../evil", Typeflag: tar.TypeReg, Mode: 0644}},
+		{
+			{Name: "./link", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "./link/evil", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		{
+			{Name: "./link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+			{Name: "./passwd", Typeflag: tar.TypeLink, Linkname: "./link/passwd"},
+		},
+	} {
+		debFile := newRawDeb(t, entries)
+		dest := filepath.Join(t.TempDir(), "root")
+		_, err := debFile.Extract(dest, deb.ExtractOptions{Rootless: true})
+		notok(t, err)
+		_, err = os.Lstat(filepath.Join(outside, "evil"))
+		assert(t, os.IsNotExist(err))
+		_, err = os.Lstat(filepath.Join(filepath.Dir(dest), "evil"))
+		assert(t, os.IsNotExist(err))
+	}
+
+	/* Absolute symlinks are fine, so long as they're not followed */
+	debFile := newRawDeb(t, []*tar.Header{
+		{Name: "./link", Typeflag: tar.TypeSymlink, Linkname: outside},
+	})
+	dest := t.TempDir()
+	_, err := debFile.Extract(dest, deb.ExtractOptions{Rootless: true})
+	isok(t, err)
+	target, err := os.Readlink(filepath.Join(dest, "link"))
+	isok(t, err)
+	assert(t, target == outside)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,100 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/hashio"
+)
+
+// BinaryIndex {{{
+
+// Given the path to a `.deb` on the filesystem, and the path the `.deb` will
+// have in the archive (relative to the archive root, such as
+// "pool/main/h/hello/hello_2.10-2_amd64.deb"), create a control.BinaryIndex
+// entry suitable for writing out to a Packages file.
+func BinaryIndexFromFile(path, filename string) (*control.BinaryIndex, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	debFile, err := Load(fd, path)
+	if err != nil {
+		return nil, err
+	}
+	defer debFile.Close()
+
+	return BinaryIndexFromDeb(debFile, fd, filename)
+}
+
+// Given a loaded Deb, and a reader containing the raw bytes of the `.deb`
+// file that it was loaded from, create a control.BinaryIndex entry with
+// the Filename, Size, MD5sum, SHA1, SHA256 and Description-md5 fields
+// set. The `filename` argument is the path of the `.deb` relative to the
+// archive root.
+//
+// All fields from the `.deb` Control file are carried over as-is.
+func BinaryIndexFromDeb(debFile *Deb, in io.Reader, filename string) (*control.BinaryIndex, error) {
+	reader, hashers, err := hashio.NewHasherReaders(
+		[]string{"md5", "sha1", "sha256"},
+		in,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, err
+	}
+
+	para := control.Paragraph{
+		Order:  []string{},
+		Values: map[string]string{},
+	}
+	for _, key := range debFile.Control.Paragraph.Order {
+		para.Set(key, debFile.Control.Paragraph.Values[key])
+	}
+
+	if description, ok := para.Values["Description"]; ok {
+		para.Set("Description-md5", control.DescriptionMD5(description))
+	}
+	para.Set("Filename", filename)
+	para.Set("Size", strconv.FormatInt(hashers[0].Size(), 10))
+	para.Set("MD5sum", fmt.Sprintf("%x", hashers[0].Sum(nil)))
+	para.Set("SHA1", fmt.Sprintf("%x", hashers[1].Sum(nil)))
+	para.Set("SHA256", fmt.Sprintf("%x", hashers[2].Sum(nil)))
+
+	ret := control.BinaryIndex{}
+	if err := control.UnpackFromParagraph(para, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,70 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+func TestBinaryIndexFromFile(t *testing.T) {
+	out := bytes.Buffer{}
+	isok(t, newTestBuilder(t, "xz").Write(&out))
+	path := filepath.Join(t.TempDir(), "hello_1.0_amd64.deb")
+	isok(t, os.WriteFile(path, out.Bytes(), 0644))
+
+	index, err := deb.BinaryIndexFromFile(path, "pool/main/h/hello/hello_1.0_amd64.deb")
+	isok(t, err)
+
+	assert(t, index.Filename == "pool/main/h/hello/hello_1.0_amd64.deb")
+	assert(t, index.Size == out.Len())
+	assert(t, index.MD5sum == fmt.Sprintf("%x", md5.Sum(out.Bytes())))
+	assert(t, index.SHA256 == fmt.Sprintf("%x", sha256.Sum256(out.Bytes())))
+	assert(t, index.DescriptionMD5 == fmt.Sprintf("%x", md5.Sum(
+		[]byte("example package\n This is an example package.\n"),
+	)))
+
+	/* Fields from the control file are copied over */
+	assert(t, index.Package == "hello")
+	assert(t, index.Version.String() == "1.0")
+	assert(t, index.Architecture.String() == "amd64")
+	assert(t, index.Maintainer == "Paul Tagliamonte <paultag@debian.org>")
+	assert(t, index.InstalledSize == 6)
+	assert(t, index.Description == "example package\nThis is an example package.\n")
+	assert(t, index.Values["Package"] == "hello")
+	assert(t, index.Values["SHA256"] == index.SHA256)
+
+	_, err = deb.BinaryIndexFromFile(filepath.Join(t.TempDir(), "missing.deb"), "missing.deb")
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
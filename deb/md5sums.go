@@ -0,0 +1,187 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"archive/tar"
+
+	"pault.ag/go/debian/hashio"
+)
+
+// VerifyMD5Sums {{{
+
+// An MD5SumsError is returned by VerifyMD5Sums when the contents of
+// data.tar don't match the md5sums control member. All paths are relative
+// to the root of the filesystem, without a leading slash.
+type MD5SumsError struct {
+	// Files listed in md5sums, but not shipped in data.tar.
+	Missing []string
+	// Regular files shipped in data.tar, but not listed in md5sums.
+	// Conffiles are not included, since they're commonly left out of
+	// md5sums.
+	Extra []string
+	// Files whose contents don't match the hash in md5sums.
+	Mismatched []string
+}
+
+func (e *MD5SumsError) Error() string {
+	problems := []string{}
+	for _, problem := range []struct {
+		name  string
+		paths []string
+	}{
+		{"missing", e.Missing},
+		{"extra", e.Extra},
+		{"mismatched", e.Mismatched},
+	} {
+		if len(problem.paths) > 0 {
+			problems = append(problems, fmt.Sprintf(
+				"%s: %s", problem.name, strings.Join(problem.paths, ", "),
+			))
+		}
+	}
+	return fmt.Sprintf("md5sums verification failed: %s", strings.Join(problems, "; "))
+}
+
+// Check every regular file in data.tar against the md5sums control member.
+// If they don't match, an *MD5SumsError explaining which files are
+// missing, extra or mismatched is returned.
+//
+// If the Deb was loaded from an io.ReaderAt, data.tar is read again from
+// the start (leaving Deb.Data untouched), otherwise this consumes Deb.Data.
+func (deb *Deb) VerifyMD5Sums() error {
+	if _, ok := deb.ControlFiles.Get("md5sums"); !ok {
+		return fmt.Errorf("No md5sums control member in the .deb")
+	}
+	md5sums, err := deb.ControlFiles.GetMD5Sums()
+	if err != nil {
+		return err
+	}
+	expected := map[string]string{}
+	for _, entry := range md5sums {
+		expected[path.Clean(entry.Path)] = entry.Hash
+	}
+	conffiles := map[string]bool{}
+	for _, conffile := range deb.ControlFiles.GetConffiles() {
+		conffiles[path.Clean(strings.TrimPrefix(conffile.Path, "/"))] = true
+	}
+
+	data, closer, err := deb.openData()
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	ret := MD5SumsError{Missing: []string{}, Extra: []string{}, Mismatched: []string{}}
+	seen := map[string]bool{}
+	/* Hashes of the regular files read so far, for hardlinks to refer to */
+	sums := map[string]string{}
+	for {
+		header, err := data.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := dataPath(header.Name)
+
+		var sum string
+		switch header.Typeflag {
+		case tar.TypeReg:
+			hasher, err := hashio.NewHasher("md5")
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(hasher, data); err != nil {
+				return err
+			}
+			sum = fmt.Sprintf("%x", hasher.Sum(nil))
+			sums[name] = sum
+		case tar.TypeLink:
+			/* Hardlinks are regular files on disk, so they're listed in
+			 * md5sums with the contents of the file they link to. */
+			sum = sums[dataPath(header.Linkname)]
+		default:
+			continue
+		}
+
+		want, ok := expected[name]
+		if !ok {
+			if !conffiles[name] {
+				ret.Extra = append(ret.Extra, name)
+			}
+			continue
+		}
+		seen[name] = true
+		if sum != want {
+			ret.Mismatched = append(ret.Mismatched, name)
+		}
+	}
+	for name := range expected {
+		if !seen[name] {
+			ret.Missing = append(ret.Missing, name)
+		}
+	}
+
+	if len(ret.Missing)+len(ret.Extra)+len(ret.Mismatched) == 0 {
+		return nil
+	}
+	sort.Strings(ret.Missing)
+	sort.Strings(ret.Extra)
+	sort.Strings(ret.Mismatched)
+	return &ret
+}
+
+// Return the path of a data.tar member relative to the root of the
+// filesystem, as it's written in md5sums.
+func dataPath(name string) string {
+	return path.Clean(strings.TrimPrefix(path.Clean("/"+name), "/"))
+}
+
+// Return a tar.Reader over data.tar, read from the start if possible.
+func (deb *Deb) openData() (*tar.Reader, io.Closer, error) {
+	for _, member := range deb.ArContent {
+		if !strings.HasPrefix(member.Name, "data.") {
+			continue
+		}
+		/* Use a fresh reader, so as not to disturb Deb.Data */
+		entry := *member
+		entry.Data = io.NewSectionReader(member.Data, 0, member.Size)
+		return entry.Tarfile()
+	}
+	if deb.Data == nil {
+		return nil, nil, fmt.Errorf("Missing or out of order .deb member 'data'")
+	}
+	return deb.Data, nil, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
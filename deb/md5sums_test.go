@@ -0,0 +1,98 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+func TestVerifyMD5Sums(t *testing.T) {
+	out := bytes.Buffer{}
+	isok(t, newTestBuilder(t, "xz").Write(&out))
+	debFile, err := deb.Load(bytes.NewReader(out.Bytes()), "hello.deb")
+	isok(t, err)
+	defer debFile.Close()
+	isok(t, debFile.VerifyMD5Sums())
+
+	/* Deb.Data is still readable from the start */
+	header, err := debFile.Data.Next()
+	isok(t, err)
+	assert(t, header.Name == "./")
+
+	/* Corrupt the md5sums, and check each kind of problem is reported */
+	debFile.ControlFiles.Members["md5sums"] = []byte(
+		"00000000000000000000000000000000  usr/bin/hello\n" +
+			"d41d8cd98f00b204e9800998ecf8427e  usr/bin/goodbye\n",
+	)
+	err = debFile.VerifyMD5Sums()
+	notok(t, err)
+	md5Err, ok := err.(*deb.MD5SumsError)
+	assert(t, ok)
+	assert(t, len(md5Err.Missing) == 1 && md5Err.Missing[0] == "usr/bin/goodbye")
+	assert(t, len(md5Err.Mismatched) == 1 && md5Err.Mismatched[0] == "usr/bin/hello")
+	/* etc/hello.conf is a conffile, so it's not reported as extra */
+	assert(t, len(md5Err.Extra) == 0)
+
+	debFile.ControlFiles.Members["conffiles"] = []byte{}
+	md5Err = debFile.VerifyMD5Sums().(*deb.MD5SumsError)
+	assert(t, len(md5Err.Extra) == 1 && md5Err.Extra[0] == "etc/hello.conf")
+}
+
+func TestVerifyMD5SumsHardlink(t *testing.T) {
+	debFile := newRawDebWithContents(t, []*tar.Header{
+		{Name: "./usr/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./usr/bin/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./usr/bin/hello", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "./usr/bin/hi", Typeflag: tar.TypeLink, Linkname: "./usr/bin/hello"},
+		{Name: "./usr/bin/hey", Typeflag: tar.TypeSymlink, Linkname: "hello"},
+	}, map[string]string{
+		"./usr/bin/hello": "#!/bin/sh\necho hello\n",
+	})
+	defer debFile.Close()
+
+	/* Hardlinks are listed with the contents of the file they link to */
+	debFile.ControlFiles.Members["md5sums"] = []byte(
+		"d604a220708aa59433ba410986cd4ffa  usr/bin/hello\n" +
+			"d604a220708aa59433ba410986cd4ffa  usr/bin/hi\n",
+	)
+	isok(t, debFile.VerifyMD5Sums())
+
+	debFile.ControlFiles.Members["md5sums"] = []byte(
+		"d604a220708aa59433ba410986cd4ffa  usr/bin/hello\n" +
+			"d41d8cd98f00b204e9800998ecf8427e  usr/bin/hi\n",
+	)
+	err := debFile.VerifyMD5Sums()
+	notok(t, err)
+	md5Err := err.(*deb.MD5SumsError)
+	assert(t, len(md5Err.Missing) == 0)
+	assert(t, len(md5Err.Extra) == 0)
+	assert(t, len(md5Err.Mismatched) == 1 && md5Err.Mismatched[0] == "usr/bin/hi")
+}
+
+// vim: foldmethod=marker
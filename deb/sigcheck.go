@@ -45,6 +45,16 @@ func (deb *Deb) CheckDebsig(validKeys openpgp.EntityList, sigType string) (signe
 	binaryFlag.Data.Seek(0, 0)
 	control.Data.Seek(0, 0)
 	data.Data.Seek(0, 0)
+	sig.Data.Seek(0, 0)
 	signedData := io.MultiReader(binaryFlag.Data, control.Data, data.Data)
+
+	/* debsigs writes out ASCII armored signatures, but binary ones are
+	 * accepted as well */
+	header := make([]byte, len(armorHeader))
+	if _, err := sig.Data.ReadAt(header, 0); err == nil && string(header) == armorHeader {
+		return openpgp.CheckArmoredDetachedSignature(validKeys, signedData, sig.Data)
+	}
 	return openpgp.CheckDetachedSignature(validKeys, signedData, sig.Data)
 }
+
+const armorHeader = "-----BEGIN PGP"
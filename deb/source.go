@@ -0,0 +1,175 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/internal"
+)
+
+// ExtractSource {{{
+
+// The files making up a source package, by role.
+type sourceFiles struct {
+	tarball    string
+	orig       string
+	components map[string]string
+	debian     string
+	diff       string
+}
+
+// Orig component names, as accepted by dpkg-source.
+var componentRegexp = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// Sort the files listed in the DSC by role, based on their names. Names
+// which could refer to files outside of the directory of the DSC, or orig
+// components which could be extracted outside of the source tree, are
+// rejected.
+func classifySourceFiles(dsc *control.DSC) (*sourceFiles, error) {
+	ret := sourceFiles{components: map[string]string{}}
+	baseDir := filepath.Dir(dsc.Filename)
+	for _, file := range dsc.Files {
+		name := file.Filename
+		if err := control.CheckSourceFilename(name); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(baseDir, name)
+		switch {
+		case strings.HasSuffix(name, ".asc"):
+			continue
+		case strings.Contains(name, ".orig-") && strings.Contains(name, ".tar"):
+			component := name[strings.Index(name, ".orig-")+6:]
+			component = component[:strings.Index(component, ".tar")]
+			if !componentRegexp.MatchString(component) {
+				return nil, fmt.Errorf("Invalid orig component name: '%s'", component)
+			}
+			ret.components[component] = path
+		case strings.Contains(name, ".orig.tar"):
+			ret.orig = path
+		case strings.Contains(name, ".debian.tar"):
+			ret.debian = path
+		case strings.HasSuffix(name, ".diff.gz"):
+			ret.diff = path
+		case strings.Contains(name, ".tar"):
+			ret.tarball = path
+		}
+	}
+	return &ret, nil
+}
+
+// Extract the source package described by `dsc` into the directory
+// `dest`, in the same way as `dpkg-source --extract`. DSC.Filename must
+// be set, and every file the DSC lists must be next to it. File names
+// which aren't plain names in that directory, and orig component names
+// other than letters, digits and "-", are rejected.
+//
+// Every file is checked against the checksums in the DSC before
+// anything is extracted. The "1.0", "3.0 (native)" and "3.0 (quilt)"
+// formats are supported. For "3.0 (quilt)", the orig tarball and any
+// orig component tarballs are extracted, the debian tarball is extracted
+// over them, and every patch in debian/patches/series is applied; the
+// quilt .pc directory isn't created. For "1.0", the .diff.gz is applied
+// on top of the orig tarball.
+//
+// Files are extracted as the current user, since a source package
+// doesn't record ownership.
+func ExtractSource(dsc *control.DSC, dest string) error {
+	files, err := classifySourceFiles(dsc)
+	if err != nil {
+		return err
+	}
+	if err := dsc.Verify(); err != nil {
+		return err
+	}
+
+	switch dsc.Format {
+	case "1.0":
+		if files.diff == "" {
+			return extractSourceTarball(files.tarball, dest, 1)
+		}
+		if err := extractSourceTarball(files.orig, dest, 1); err != nil {
+			return err
+		}
+		if err := internal.ApplyPatchFile(dest, files.diff, 1); err != nil {
+			return err
+		}
+		/* A diff can't carry the executable bit, so dpkg-source sets it */
+		return os.Chmod(filepath.Join(dest, "debian", "rules"), 0755)
+	case "3.0 (native)":
+		return extractSourceTarball(files.tarball, dest, 1)
+	case "3.0 (quilt)":
+		if err := extractSourceTarball(files.orig, dest, 1); err != nil {
+			return err
+		}
+		for component, path := range files.components {
+			if err := extractSourceTarball(path, filepath.Join(dest, component), 1); err != nil {
+				return err
+			}
+		}
+		/* The debian tarball replaces any debian/ directory upstream ships */
+		if err := os.RemoveAll(filepath.Join(dest, "debian")); err != nil {
+			return err
+		}
+		if err := extractSourceTarball(files.debian, dest, 0); err != nil {
+			return err
+		}
+		return internal.ApplySeries(dest, dest)
+	default:
+		return fmt.Errorf("Unsupported source format: '%s'", dsc.Format)
+	}
+}
+
+// }}}
+
+// ExtractSource Internals {{{
+
+// Extract the tarball at `path` into `dest`, removing `strip` leading
+// components from every name.
+func extractSourceTarball(path, dest string, strip int) error {
+	if path == "" {
+		return fmt.Errorf("Missing tarball for %s", dest)
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	decompressed, err := DecompressorFor(filepath.Ext(path))(fd)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+
+	_, err = extractTar(tar.NewReader(decompressed), dest, ExtractOptions{Rootless: true}, strip)
+	return err
+}
+
+// }}}
+
+// vim: foldmethod=marker
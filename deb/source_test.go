@@ -0,0 +1,280 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+// Test Source Package {{{
+const testSourceControl = `Source: hello
+Maintainer: Paul Tagliamonte <paultag@debian.org>
+
+Package: hello
+Architecture: any
+Description: example package
+`
+
+const testSourcePatch = `Description: Say hello louder
+Author: Paul Tagliamonte <paultag@debian.org>
+
+--- a/src/hello.c
++++ b/src/hello.c
+@@ -3,3 +3,3 @@
+ int main() {
+-	puts("hello");
++	puts("HELLO");
+ 	return 0;
+--- /dev/null
++++ b/README
+@@ -0,0 +1 @@
++hello
+\ No newline at end of file
+`
+
+const testSourceC = `#include <stdio.h>
+
+int main() {
+	puts("hello");
+	return 0;
+}
+`
+
+// }}}
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		isok(t, os.MkdirAll(filepath.Dir(path), 0755))
+		isok(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestExtractSourceQuilt(t *testing.T) {
+	dir := t.TempDir()
+	tree := filepath.Join(dir, "hello")
+	writeTestFiles(t, tree, map[string]string{
+		"debian/control":       testSourceControl,
+		"debian/source/format": "3.0 (quilt)\n",
+		"debian/changelog": "hello (1.0-1) unstable; urgency=medium\n\n" +
+			"  * Initial release.\n\n" +
+			" -- Paul Tagliamonte <paultag@debian.org>  Tue, 14 Nov 2023 22:13:20 +0000\n",
+		"debian/patches/series":       "# Patches\nlouder.patch -p1\n",
+		"debian/patches/louder.patch": testSourcePatch,
+		"src/hello.c":                 "/* The hello program */\n" + testSourceC,
+	})
+	builder, err := control.NewDSCBuilder(tree)
+	isok(t, err)
+	builder.CreateOrig = true
+	dsc, err := builder.Build(dir)
+	isok(t, err)
+
+	dest := filepath.Join(dir, "extracted")
+	isok(t, deb.ExtractSource(dsc, dest))
+
+	/* The hunk applies one line later than the patch says */
+	hello, err := os.ReadFile(filepath.Join(dest, "src", "hello.c"))
+	isok(t, err)
+	assert(t, bytes.Contains(hello, []byte(`puts("HELLO");`)))
+	assert(t, !bytes.Contains(hello, []byte(`puts("hello");`)))
+
+	readme, err := os.ReadFile(filepath.Join(dest, "README"))
+	isok(t, err)
+	assert(t, string(readme) == "hello")
+
+	changelog, err := os.ReadFile(filepath.Join(dest, "debian", "changelog"))
+	isok(t, err)
+	assert(t, bytes.HasPrefix(changelog, []byte("hello (1.0-1)")))
+
+	/* Anything which doesn't match the checksums is refused */
+	isok(t, os.WriteFile(filepath.Join(dir, dsc.Files[1].Filename), []byte("garbage"), 0644))
+	notok(t, deb.ExtractSource(dsc, filepath.Join(dir, "tampered")))
+	_, err = os.Stat(filepath.Join(dir, "tampered"))
+	assert(t, os.IsNotExist(err))
+}
+
+func TestExtractSourceSeriesTraversal(t *testing.T) {
+	dir := t.TempDir()
+	evil := filepath.Join(dir, "evil.patch")
+	isok(t, os.WriteFile(evil, []byte(testSourcePatch), 0644))
+
+	for i, series := range []string{
+		"../../../evil.patch\n",
+		evil + "\n",
+		"link.patch\n",
+		"outside/evil.patch\n",
+	} {
+		tree := filepath.Join(dir, fmt.Sprintf("hello-%d", i))
+		writeTestFiles(t, tree, map[string]string{
+			"debian/control":       testSourceControl,
+			"debian/source/format": "3.0 (quilt)\n",
+			"debian/changelog": "hello (1.0-1) unstable; urgency=medium\n\n" +
+				"  * Initial release.\n\n" +
+				" -- Paul Tagliamonte <paultag@debian.org>  Tue, 14 Nov 2023 22:13:20 +0000\n",
+			"debian/patches/series": series,
+			"src/hello.c":           testSourceC,
+		})
+		isok(t, os.Symlink(evil, filepath.Join(tree, "debian", "patches", "link.patch")))
+		isok(t, os.Symlink(dir, filepath.Join(tree, "debian", "patches", "outside")))
+
+		output := filepath.Join(dir, fmt.Sprintf("output-%d", i))
+		isok(t, os.Mkdir(output, 0755))
+		builder, err := control.NewDSCBuilder(tree)
+		isok(t, err)
+		builder.CreateOrig = true
+		dsc, err := builder.Build(output)
+		isok(t, err)
+
+		dest := filepath.Join(output, "extracted")
+		notok(t, deb.ExtractSource(dsc, dest))
+		_, err = os.Stat(filepath.Join(dest, "README"))
+		assert(t, os.IsNotExist(err))
+	}
+}
+
+func TestExtractSourceBadComponent(t *testing.T) {
+	dir := t.TempDir()
+	tree := filepath.Join(dir, "src", "hello")
+	writeTestFiles(t, tree, map[string]string{
+		"debian/control":       testSourceControl,
+		"debian/source/format": "3.0 (quilt)\n",
+		"debian/changelog": "hello (1.0-1) unstable; urgency=medium\n\n" +
+			"  * Initial release.\n\n" +
+			" -- Paul Tagliamonte <paultag@debian.org>  Tue, 14 Nov 2023 22:13:20 +0000\n",
+		"src/hello.c": testSourceC,
+	})
+	output := filepath.Join(dir, "src")
+	builder, err := control.NewDSCBuilder(tree)
+	isok(t, err)
+	builder.CreateOrig = true
+	dsc, err := builder.Build(output)
+	isok(t, err)
+
+	/* A tarball which would put evil/pwned next to the output directory */
+	evil := bytes.Buffer{}
+	compressed := gzip.NewWriter(&evil)
+	archive := tar.NewWriter(compressed)
+	isok(t, archive.WriteHeader(&tar.Header{Name: "x/evil/pwned", Typeflag: tar.TypeReg, Mode: 0644}))
+	isok(t, archive.Close())
+	isok(t, compressed.Close())
+	isok(t, os.WriteFile(filepath.Join(output, "evil.tar.gz"), evil.Bytes(), 0644))
+	isok(t, os.WriteFile(filepath.Join(output, "hello_1.0.orig-bad_name.tar.gz"), evil.Bytes(), 0644))
+
+	for _, name := range []string{
+		"hello_1.0.orig-../../evil.tar.gz",
+		"hello_1.0.orig-bad_name.tar.gz",
+	} {
+		tampered := *dsc
+		tampered.Files = append(append([]control.MD5FileHash{}, dsc.Files...), control.MD5FileHash{
+			FileHash: control.FileHash{
+				Algorithm: "md5",
+				Hash:      fmt.Sprintf("%x", md5.Sum(evil.Bytes())),
+				Size:      int64(evil.Len()),
+				Filename:  name,
+			},
+		})
+		dest := filepath.Join(output, "extracted", "hello")
+		notok(t, deb.ExtractSource(&tampered, dest))
+		_, err = os.Stat(filepath.Join(dir, "evil"))
+		assert(t, os.IsNotExist(err))
+		_, err = os.Stat(dest)
+		assert(t, os.IsNotExist(err))
+	}
+
+	/* Verify refuses to open files outside of the directory of the .dsc */
+	tampered := *dsc
+	tampered.Files = []control.MD5FileHash{{FileHash: control.FileHash{
+		Algorithm: "md5", Filename: "../src/evil.tar.gz",
+	}}}
+	notok(t, tampered.Verify())
+}
+
+func TestExtractSource1(t *testing.T) {
+	dir := t.TempDir()
+
+	orig := bytes.Buffer{}
+	compressed := gzip.NewWriter(&orig)
+	archive := tar.NewWriter(compressed)
+	isok(t, archive.WriteHeader(&tar.Header{Name: "hello-1.0/", Typeflag: tar.TypeDir, Mode: 0755}))
+	isok(t, archive.WriteHeader(&tar.Header{
+		Name: "hello-1.0/hello.c", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(testSourceC)),
+	}))
+	_, err := archive.Write([]byte(testSourceC))
+	isok(t, err)
+	isok(t, archive.Close())
+	isok(t, compressed.Close())
+
+	diff := bytes.Buffer{}
+	compressed = gzip.NewWriter(&diff)
+	_, err = compressed.Write([]byte(`--- hello-1.0.orig/debian/rules
++++ hello-1.0/debian/rules
+@@ -0,0 +1,3 @@
++#!/usr/bin/make -f
++%:
++	dh $@
+`))
+	isok(t, err)
+	isok(t, compressed.Close())
+
+	dsc := control.DSC{Filename: filepath.Join(dir, "hello_1.0-1.dsc"), Format: "1.0"}
+	for name, data := range map[string][]byte{
+		"hello_1.0.orig.tar.gz": orig.Bytes(),
+		"hello_1.0-1.diff.gz":   diff.Bytes(),
+	} {
+		isok(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+		dsc.Files = append(dsc.Files, control.MD5FileHash{FileHash: control.FileHash{
+			Algorithm: "md5",
+			Hash:      fmt.Sprintf("%x", md5.Sum(data)),
+			Size:      int64(len(data)),
+			Filename:  name,
+		}})
+	}
+
+	dest := filepath.Join(dir, "extracted")
+	isok(t, deb.ExtractSource(&dsc, dest))
+
+	hello, err := os.ReadFile(filepath.Join(dest, "hello.c"))
+	isok(t, err)
+	assert(t, string(hello) == testSourceC)
+
+	info, err := os.Stat(filepath.Join(dest, "debian", "rules"))
+	isok(t, err)
+	assert(t, info.Mode().Perm() == 0755)
+
+	dsc.Format = "2.0"
+	notok(t, deb.ExtractSource(&dsc, filepath.Join(dir, "unsupported")))
+}
+
+// vim: foldmethod=marker
@@ -28,44 +28,19 @@ import (
 
 	"archive/tar"
 
-	"compress/bzip2"
-	"compress/gzip"
-
-	"github.com/kjk/lzma"
-	"github.com/klauspost/compress/zstd"
-	"github.com/xi2/xz"
+	"pault.ag/go/debian/hashio"
 )
 
 // known compression types {{{
 
-type DecompressorFunc func(io.Reader) (io.ReadCloser, error)
-
-func gzipNewReader(r io.Reader) (io.ReadCloser, error) {
-	return gzip.NewReader(r)
-}
-
-func xzNewReader(r io.Reader) (io.ReadCloser, error) {
-	reader, err := xz.NewReader(r, 0)
-	if err != nil {
-		return nil, err
-	}
-	return io.NopCloser(reader), nil
-}
-
-func lzmaNewReader(r io.Reader) (io.ReadCloser, error) {
-	return lzma.NewReader(r), nil
-}
-
-func bzipNewReader(r io.Reader) (io.ReadCloser, error) {
-	return io.NopCloser(bzip2.NewReader(r)), nil
-}
+type DecompressorFunc = hashio.Decompressor
 
-func zstdNewReader(r io.Reader) (io.ReadCloser, error) {
-	reader, err := zstd.NewReader(r)
+func decompressor(name string) DecompressorFunc {
+	decompressor, err := hashio.GetDecompressor(name)
 	if err != nil {
-		return nil, err
+		panic(err)
 	}
-	return io.NopCloser(reader), err
+	return decompressor
 }
 
 // For the authoritative list of supported file formats, see
@@ -73,11 +48,11 @@ func zstdNewReader(r io.Reader) (io.ReadCloser, error) {
 // zstd-compressed packages are not yet (08-2021) officially supported by Debian, but they
 // are used by Ubuntu.
 var knownCompressionAlgorithms = map[string]DecompressorFunc{
-	".gz":   gzipNewReader,
-	".bz2":  bzipNewReader,
-	".xz":   xzNewReader,
-	".lzma": lzmaNewReader,
-	".zst":  zstdNewReader,
+	".gz":   decompressor("gz"),
+	".bz2":  decompressor("bz2"),
+	".xz":   decompressor("xz"),
+	".lzma": decompressor("lzma"),
+	".zst":  decompressor("zst"),
 }
 
 // DecompressorFn returns a decompressing reader for the specified reader and its
@@ -93,13 +68,7 @@ func DecompressorFor(ext string) DecompressorFunc {
 // decompressing. If zero is supplied, the default max dictionary size will be
 // used.
 func SetXZMaxDict(maxDict uint32) {
-	knownCompressionAlgorithms[".xz"] = func(r io.Reader) (io.ReadCloser, error) {
-		reader, err := xz.NewReader(r, maxDict)
-		if err != nil {
-			return nil, err
-		}
-		return io.NopCloser(reader), nil
-	}
+	knownCompressionAlgorithms[".xz"] = hashio.NewXZDecompressor(maxDict)
 }
 
 // }}}
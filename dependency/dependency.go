@@ -43,6 +43,115 @@ func (dep *Dependency) GetPossibilities(arch Arch) []Possibility {
 	return possies
 }
 
+// GetRelations returns the Relations of this Dependency which apply to the
+// given Arch. Each returned Relation only contains the Possibilities that
+// apply to the Arch, in their original order, and Relations left without
+// any Possibilities (as well as substvars) are dropped.
+//
+// Unlike GetPossibilities, alternatives are kept, which is what's needed
+// to check whether a Relation can be satisfied.
+func (dep *Dependency) GetRelations(arch Arch) []Relation {
+	return dep.getRelations(arch, nil)
+}
+
+// Matches checks to see if this Stage applies when building with the given
+// set of active build profiles. A Stage such as "nocheck" matches if the
+// profile is active, and a negated Stage such as "!nocheck" matches if it
+// is not.
+func (stage Stage) Matches(profiles []string) bool {
+	for _, profile := range profiles {
+		if profile == stage.Name {
+			return !stage.Not
+		}
+	}
+	return stage.Not
+}
+
+// Matches checks to see if every Stage in this StageSet applies when
+// building with the given set of active build profiles.
+func (stageSet StageSet) Matches(profiles []string) bool {
+	for _, stage := range stageSet.Stages {
+		if !stage.Matches(profiles) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesProfiles checks to see if the restriction formula of this
+// Possibility applies when building with the given set of active build
+// profiles. Each StageSet (such as `<!nocheck stage1>`) is a list of terms
+// that must all be true, and the Possibility applies if any one of its
+// StageSets does. A Possibility without any StageSets always applies.
+func (possi Possibility) MatchesProfiles(profiles []string) bool {
+	if len(possi.StageSets) == 0 {
+		return true
+	}
+	for _, stageSet := range possi.StageSets {
+		if stageSet.Matches(profiles) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPossibilitiesWithProfiles is like GetPossibilities, but also drops any
+// Possibilities whose restriction formula doesn't apply when building with
+// the given set of active build profiles (such as "nocheck" or "stage1").
+func (dep *Dependency) GetPossibilitiesWithProfiles(arch Arch, profiles []string) []Possibility {
+	possies := []Possibility{}
+
+	for _, relation := range dep.Relations {
+		for _, possibility := range relation.Possibilities {
+			if possibility.Substvar {
+				continue
+			}
+
+			if possibility.Architectures.Matches(&arch) && possibility.MatchesProfiles(profiles) {
+				possies = append(possies, possibility)
+				break
+			}
+		}
+	}
+
+	return possies
+}
+
+// GetRelationsWithProfiles is like GetRelations, but also drops any
+// Possibilities whose restriction formula doesn't apply when building with
+// the given set of active build profiles.
+func (dep *Dependency) GetRelationsWithProfiles(arch Arch, profiles []string) []Relation {
+	return dep.getRelations(arch, &profiles)
+}
+
+// getRelations backs GetRelations and GetRelationsWithProfiles. Restriction
+// formulas are only checked if `profiles` is non-nil, since an empty set of
+// active profiles still rules out Possibilities such as `foo <stage1>`.
+func (dep *Dependency) getRelations(arch Arch, profiles *[]string) []Relation {
+	relations := []Relation{}
+
+	for _, relation := range dep.Relations {
+		possies := []Possibility{}
+		for _, possibility := range relation.Possibilities {
+			if possibility.Substvar {
+				continue
+			}
+			if !possibility.Architectures.Matches(&arch) {
+				continue
+			}
+			if profiles != nil && !possibility.MatchesProfiles(*profiles) {
+				continue
+			}
+			possies = append(possies, possibility)
+		}
+		if len(possies) > 0 {
+			relations = append(relations, Relation{Possibilities: possies})
+		}
+	}
+
+	return relations
+}
+
 func (dep *Dependency) GetAllPossibilities() []Possibility {
 	possies := []Possibility{}
 
@@ -21,6 +21,7 @@
 package dependency_test
 
 import (
+	"strings"
 	"testing"
 
 	"pault.ag/go/debian/dependency"
@@ -118,4 +119,64 @@ func TestVersionRelationSatisfiedBy(t *testing.T) {
 	}
 }
 
+func TestGetRelations(t *testing.T) {
+	dep, err := dependency.Parse("foo, bar [sparc] | baz, quux [sparc], ${misc:Depends}")
+	isok(t, err)
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	relations := dep.GetRelations(*arch)
+	assert(t, len(relations) == 2)
+	assert(t, len(relations[0].Possibilities) == 1)
+	assert(t, relations[0].Possibilities[0].Name == "foo")
+	assert(t, len(relations[1].Possibilities) == 1)
+	assert(t, relations[1].Possibilities[0].Name == "baz")
+
+	arch, err = dependency.ParseArch("sparc")
+	isok(t, err)
+	relations = dep.GetRelations(*arch)
+	assert(t, len(relations) == 3)
+	assert(t, len(relations[1].Possibilities) == 2)
+}
+
+func TestGetPossibilitiesWithProfiles(t *testing.T) {
+	dep, err := dependency.Parse(
+		"debhelper, python3-pytest <!nocheck>, libfoo-dev <!stage1 !nocheck> <pkg.foo.bar>, " +
+			"libbar-dev <stage1> | libbaz-dev",
+	)
+	isok(t, err)
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	names := func(possies []dependency.Possibility) string {
+		ret := []string{}
+		for _, possi := range possies {
+			ret = append(ret, possi.Name)
+		}
+		return strings.Join(ret, " ")
+	}
+
+	assert(t, names(dep.GetPossibilitiesWithProfiles(*arch, nil)) ==
+		"debhelper python3-pytest libfoo-dev libbaz-dev")
+	assert(t, names(dep.GetPossibilitiesWithProfiles(*arch, []string{"nocheck"})) ==
+		"debhelper libbaz-dev")
+	assert(t, names(dep.GetPossibilitiesWithProfiles(*arch, []string{"nocheck", "pkg.foo.bar"})) ==
+		"debhelper libfoo-dev libbaz-dev")
+	assert(t, names(dep.GetPossibilitiesWithProfiles(*arch, []string{"stage1"})) ==
+		"debhelper python3-pytest libbar-dev")
+
+	relations := dep.GetRelationsWithProfiles(*arch, []string{"stage1"})
+	assert(t, len(relations) == 3)
+	assert(t, len(relations[2].Possibilities) == 2)
+
+	/* No active profiles still rules out <stage1>, but GetRelations
+	 * ignores restriction formulas entirely */
+	relations = dep.GetRelationsWithProfiles(*arch, nil)
+	assert(t, len(relations) == 4)
+	assert(t, len(relations[3].Possibilities) == 1)
+	relations = dep.GetRelations(*arch)
+	assert(t, len(relations) == 4)
+	assert(t, len(relations[3].Possibilities) == 2)
+}
+
 // vim: foldmethod=marker
@@ -5,6 +5,9 @@ import (
 	"io"
 
 	"compress/gzip"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 type Compressor func(io.Writer) (io.WriteCloser, error)
@@ -13,8 +16,18 @@ func gzipCompressor(in io.Writer) (io.WriteCloser, error) {
 	return gzip.NewWriter(in), nil
 }
 
+func xzCompressor(in io.Writer) (io.WriteCloser, error) {
+	return xz.NewWriter(in)
+}
+
+func zstdCompressor(in io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(in)
+}
+
 var knownCompressors = map[string]Compressor{
-	"gz": gzipCompressor,
+	"gz":  gzipCompressor,
+	"xz":  xzCompressor,
+	"zst": zstdCompressor,
 }
 
 func GetCompressor(name string) (Compressor, error) {
@@ -0,0 +1,63 @@
+package hashio // import "pault.ag/go/debian/hashio"
+
+import (
+	"fmt"
+	"io"
+
+	"compress/bzip2"
+	"compress/gzip"
+
+	"github.com/kjk/lzma"
+	"github.com/klauspost/compress/zstd"
+	"github.com/xi2/xz"
+)
+
+type Decompressor func(io.Reader) (io.ReadCloser, error)
+
+func gzipDecompressor(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func lzmaDecompressor(r io.Reader) (io.ReadCloser, error) {
+	return lzma.NewReader(r), nil
+}
+
+func bzipDecompressor(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(r)), nil
+}
+
+func zstdDecompressor(r io.Reader) (io.ReadCloser, error) {
+	reader, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(reader), err
+}
+
+// NewXZDecompressor returns an xz Decompressor which allows dictionaries of
+// up to maxDict bytes. If zero is supplied, the default max dictionary size
+// will be used.
+func NewXZDecompressor(maxDict uint32) Decompressor {
+	return func(r io.Reader) (io.ReadCloser, error) {
+		reader, err := xz.NewReader(r, maxDict)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	}
+}
+
+var knownDecompressors = map[string]Decompressor{
+	"gz":   gzipDecompressor,
+	"bz2":  bzipDecompressor,
+	"xz":   NewXZDecompressor(0),
+	"lzma": lzmaDecompressor,
+	"zst":  zstdDecompressor,
+}
+
+func GetDecompressor(name string) (Decompressor, error) {
+	if decompressor, ok := knownDecompressors[name]; ok {
+		return decompressor, nil
+	}
+	return nil, fmt.Errorf("No such decompressor: '%s'", name)
+}
@@ -0,0 +1,299 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A hunk of a unified diff. Lines include their trailing newline, unless
+// they're the last line of a file without one.
+type hunk struct {
+	oldStart int
+	oldLines []string
+	newLines []string
+}
+
+// The changes to a single file in a unified diff.
+type filePatch struct {
+	oldName string
+	newName string
+	hunks   []hunk
+}
+
+// ApplyPatch applies the unified diff read from `patch` to the files under
+// `dir`, stripping `strip` leading components from the file names in the
+// diff, as `patch -p<strip>` would. Hunks may be found at an offset from
+// where the diff says they are, but must otherwise match exactly.
+func ApplyPatch(dir string, patch io.Reader, strip int) error {
+	patches, err := parsePatch(patch)
+	if err != nil {
+		return err
+	}
+	for _, filePatch := range patches {
+		if err := filePatch.apply(dir, strip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse {{{
+
+func parsePatch(patch io.Reader) ([]filePatch, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(patch)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	ret := []filePatch{}
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "--- ") || i+1 >= len(lines) ||
+			!strings.HasPrefix(lines[i+1], "+++ ") {
+			/* Anything outside of a file's changes is commentary */
+			continue
+		}
+		current := filePatch{
+			oldName: patchName(lines[i]),
+			newName: patchName(lines[i+1]),
+			hunks:   []hunk{},
+		}
+		i += 2
+
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@ ") {
+			next, consumed, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, err
+			}
+			current.hunks = append(current.hunks, *next)
+			i += consumed
+		}
+		i--
+
+		if len(current.hunks) == 0 {
+			return nil, fmt.Errorf("No hunks for '%s' in patch", current.newName)
+		}
+		ret = append(ret, current)
+	}
+	return ret, nil
+}
+
+// Return the file name from a "--- " or "+++ " line, without any
+// timestamp following it.
+func patchName(line string) string {
+	name := line[4:]
+	if i := strings.Index(name, "\t"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSpace(name)
+}
+
+// Parse "-start,count" or "+start,count" from a hunk header.
+func parseRange(value string) (int, int, error) {
+	start, count, found := strings.Cut(value[1:], ",")
+	if !found {
+		count = "1"
+	}
+	startN, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	countN, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, 0, err
+	}
+	return startN, countN, nil
+}
+
+// Parse the hunk starting at lines[0], and return it along with the
+// number of lines it takes up.
+func parseHunk(lines []string) (*hunk, int, error) {
+	fields := strings.Fields(lines[0])
+	if len(fields) < 4 || fields[3] != "@@" {
+		return nil, 0, fmt.Errorf("Malformed hunk header: '%s'", lines[0])
+	}
+	oldStart, oldCount, err := parseRange(fields[1])
+	if err != nil {
+		return nil, 0, fmt.Errorf("Malformed hunk header: '%s'", lines[0])
+	}
+	_, newCount, err := parseRange(fields[2])
+	if err != nil {
+		return nil, 0, fmt.Errorf("Malformed hunk header: '%s'", lines[0])
+	}
+
+	ret := hunk{oldStart: oldStart, oldLines: []string{}, newLines: []string{}}
+	i := 1
+	var last byte
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "\\") {
+			/* "\ No newline at end of file" applies to the line before */
+			if last == ' ' || last == '-' {
+				ret.oldLines[len(ret.oldLines)-1] = strings.TrimSuffix(ret.oldLines[len(ret.oldLines)-1], "\n")
+			}
+			if last == ' ' || last == '+' {
+				ret.newLines[len(ret.newLines)-1] = strings.TrimSuffix(ret.newLines[len(ret.newLines)-1], "\n")
+			}
+			continue
+		}
+		if len(ret.oldLines) == oldCount && len(ret.newLines) == newCount {
+			break
+		}
+		if line == "" {
+			/* Some tools strip the trailing space from empty context lines */
+			line = " "
+		}
+		last = line[0]
+		switch last {
+		case ' ':
+			ret.oldLines = append(ret.oldLines, line[1:]+"\n")
+			ret.newLines = append(ret.newLines, line[1:]+"\n")
+		case '-':
+			ret.oldLines = append(ret.oldLines, line[1:]+"\n")
+		case '+':
+			ret.newLines = append(ret.newLines, line[1:]+"\n")
+		default:
+			return nil, 0, fmt.Errorf("Unexpected '%s' in hunk", line)
+		}
+	}
+	if len(ret.oldLines) != oldCount || len(ret.newLines) != newCount {
+		return nil, 0, fmt.Errorf("Truncated hunk: '%s'", lines[0])
+	}
+	return &ret, i, nil
+}
+
+// }}}
+
+// Apply {{{
+
+// Return the path of `name` under `dir`, after stripping `strip`
+// leading components, or an error if it's outside of `dir`.
+func patchTarget(dir, name string, strip int) (string, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) <= strip {
+		return "", fmt.Errorf("Can't strip %d components from '%s'", strip, name)
+	}
+	cleaned := path.Clean(strings.Join(parts[strip:], "/"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("Refusing to patch '%s' outside of the tree", name)
+	}
+
+	current := dir
+	for _, part := range strings.Split(path.Dir(cleaned), "/") {
+		if part == "." {
+			continue
+		}
+		current = filepath.Join(current, part)
+		if info, err := os.Lstat(current); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("Refusing to patch '%s' through a symlink", name)
+		}
+	}
+	target := filepath.Join(dir, filepath.FromSlash(cleaned))
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("Refusing to patch the symlink '%s'", name)
+	}
+	return target, nil
+}
+
+func (p filePatch) apply(dir string, strip int) error {
+	name := p.newName
+	if name == "/dev/null" {
+		name = p.oldName
+	}
+	target, err := patchTarget(dir, name, strip)
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	lines := []string{}
+	if p.oldName != "/dev/null" {
+		info, err := os.Stat(target)
+		if err == nil {
+			mode = info.Mode().Perm()
+			data, err := os.ReadFile(target)
+			if err != nil {
+				return err
+			}
+			lines = strings.SplitAfter(string(data), "\n")
+			if lines[len(lines)-1] == "" {
+				lines = lines[:len(lines)-1]
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	/* Hunks are applied in order, so each is looked for after the last */
+	minimum := 0
+	offset := 0
+	for _, hunk := range p.hunks {
+		expected := hunk.oldStart - 1 + offset
+		if len(hunk.oldLines) == 0 {
+			expected++
+		}
+		position := findHunk(lines, hunk.oldLines, expected, minimum)
+		if position < 0 {
+			return fmt.Errorf("Hunk at line %d of '%s' doesn't apply", hunk.oldStart, name)
+		}
+		patched := append([]string{}, lines[:position]...)
+		patched = append(patched, hunk.newLines...)
+		patched = append(patched, lines[position+len(hunk.oldLines):]...)
+		lines = patched
+
+		offset = position + len(hunk.newLines) - (hunk.oldStart - 1 + len(hunk.oldLines))
+		if len(hunk.oldLines) == 0 {
+			offset--
+		}
+		minimum = position + len(hunk.newLines)
+	}
+
+	if p.newName == "/dev/null" {
+		return os.Remove(target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, []byte(strings.Join(lines, "")), mode)
+}
+
+// Find where `want` appears in `lines`, as close as possible to
+// `expected`, without starting before `minimum`. Returns -1 if it isn't
+// there at all.
+func findHunk(lines, want []string, expected, minimum int) int {
+	last := len(lines) - len(want)
+	for delta := 0; expected-delta >= minimum || expected+delta <= last; delta++ {
+		for _, position := range []int{expected - delta, expected + delta} {
+			if position < minimum || position > last {
+				continue
+			}
+			if matchesAt(lines, want, position) {
+				return position
+			}
+		}
+	}
+	return -1
+}
+
+func matchesAt(lines, want []string, position int) bool {
+	for i, line := range want {
+		if lines[position+i] != line {
+			return false
+		}
+	}
+	return true
+}
+
+// }}}
+
+// vim: foldmethod=marker
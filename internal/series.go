@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pault.ag/go/debian/hashio"
+)
+
+// ApplyPatchFile applies the (possibly compressed) patch at `path` to the
+// tree at `dest`.
+func ApplyPatchFile(dest, path string, strip int) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	var reader io.Reader = fd
+	if decompressor, err := hashio.GetDecompressor(strings.TrimPrefix(filepath.Ext(path), ".")); err == nil {
+		decompressed, err := decompressor(fd)
+		if err != nil {
+			return err
+		}
+		defer decompressed.Close()
+		reader = decompressed
+	}
+
+	if err := ApplyPatch(dest, reader, strip); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// ApplySeries applies the patches listed in debian/patches/series of the
+// source tree at `root` to the tree at `dest`, in order. Each line names a
+// patch, optionally followed by a "-pN" option. `root` and `dest` are the
+// same directory when extracting a source package.
+func ApplySeries(dest, root string) error {
+	series, err := seriesPatchPath(root, "series")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fd, err := os.Open(series)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		strip := 1
+		for _, option := range fields[1:] {
+			if !strings.HasPrefix(option, "-p") {
+				return fmt.Errorf("Unsupported option '%s' for patch %s", option, fields[0])
+			}
+			if strip, err = strconv.Atoi(option[2:]); err != nil {
+				return fmt.Errorf("Unsupported option '%s' for patch %s", option, fields[0])
+			}
+		}
+
+		path, err := seriesPatchPath(root, fields[0])
+		if err != nil {
+			return err
+		}
+		if err := ApplyPatchFile(dest, path, strip); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Return the path of the file `name` in debian/patches. Both the series
+// file and the patches come from the (untrusted) debian tarball, so the
+// name must be relative, the file must be a regular file (and not a
+// symlink), and it must really be inside of debian/patches, even once any
+// symlinked directories have been followed.
+func seriesPatchPath(root, name string) (string, error) {
+	if !filepath.IsLocal(name) || strings.Contains(name, "..") {
+		return "", fmt.Errorf("Patch %s is outside of debian/patches", name)
+	}
+	path := filepath.Join(root, "debian", "patches", name)
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("Patch %s is not a regular file", name)
+	}
+
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(filepath.Join(resolvedRoot, "debian", "patches"), resolved)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("Patch %s is outside of debian/patches", name)
+	}
+	return path, nil
+}
@@ -0,0 +1,11 @@
+package internal
+
+// OrDash returns `value`, or "-" if it's empty, as used for unknown
+// Section and Priority values in .dsc Package-List and .changes Files
+// entries.
+func OrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
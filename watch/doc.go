@@ -0,0 +1,4 @@
+/*
+Parse debian/watch files, and find new upstream releases with them.
+*/
+package watch // import "pault.ag/go/debian/watch"
@@ -0,0 +1,374 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch // import "pault.ag/go/debian/watch"
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Mangle {{{
+
+// A Mangle is a single Perl-style rule used by uscan to rewrite version
+// strings and file names, such as the rules given to the uversionmangle,
+// dversionmangle and filenamemangle options of a debian/watch file.
+//
+// Two kinds of rule are supported: substitutions (`s/pattern/replacement/`,
+// with the `g` and `i` flags), and transliterations (`tr/abc/xyz/` or
+// `y/abc/xyz/`, with the `d` flag). Patterns are Go regular expressions,
+// which match the Perl syntax commonly used in watch files, but don't
+// support look-around assertions or backreferences.
+type Mangle struct {
+	Rule string
+
+	regexp      *regexp.Regexp
+	replacement string
+	global      bool
+
+	from   []rune
+	to     []rune
+	delete bool
+}
+
+// Parse a single mangle rule, such as `s/-/./g` or `tr/A-Z/a-z/`.
+func ParseMangle(rule string) (*Mangle, error) {
+	rule = strings.TrimSpace(rule)
+	ret := Mangle{Rule: rule}
+
+	var body string
+	switch {
+	case strings.HasPrefix(rule, "s"):
+		body = rule[1:]
+	case strings.HasPrefix(rule, "tr"):
+		body = rule[2:]
+	case strings.HasPrefix(rule, "y"):
+		body = rule[1:]
+	default:
+		return nil, fmt.Errorf("Unknown mangle rule: '%s'", rule)
+	}
+
+	from, to, flags, err := splitMangle(body)
+	if err != nil {
+		return nil, fmt.Errorf("Bad mangle rule '%s': %s", rule, err)
+	}
+
+	if rule[0] == 's' {
+		expression := from
+		for _, flag := range flags {
+			switch flag {
+			case 'g':
+				ret.global = true
+			case 'i':
+				expression = "(?i)" + expression
+			default:
+				return nil, fmt.Errorf("Bad mangle rule '%s': unknown flag '%c'", rule, flag)
+			}
+		}
+		ret.regexp, err = regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("Bad mangle rule '%s': %s", rule, err)
+		}
+		ret.replacement = perlReplacement(to)
+		return &ret, nil
+	}
+
+	for _, flag := range flags {
+		switch flag {
+		case 'd':
+			ret.delete = true
+		default:
+			return nil, fmt.Errorf("Bad mangle rule '%s': unknown flag '%c'", rule, flag)
+		}
+	}
+	ret.from = expandRanges(from)
+	ret.to = expandRanges(to)
+	if len(ret.to) == 0 && !ret.delete {
+		ret.to = ret.from
+	}
+	return &ret, nil
+}
+
+// Apply the rule to the given string, returning the rewritten string.
+func (m Mangle) Apply(in string) string {
+	if m.regexp == nil {
+		return m.transliterate(in)
+	}
+
+	if m.global {
+		return m.regexp.ReplaceAllString(in, m.replacement)
+	}
+
+	match := m.regexp.FindStringSubmatchIndex(in)
+	if match == nil {
+		return in
+	}
+	ret := []byte(in[:match[0]])
+	ret = m.regexp.ExpandString(ret, m.replacement, in, match)
+	return string(ret) + in[match[1]:]
+}
+
+func (m Mangle) String() string {
+	return m.Rule
+}
+
+func (m Mangle) transliterate(in string) string {
+	ret := strings.Builder{}
+	for _, r := range in {
+		index := -1
+		for i, el := range m.from {
+			if el == r {
+				index = i
+				break
+			}
+		}
+		switch {
+		case index < 0:
+			ret.WriteRune(r)
+		case index < len(m.to):
+			ret.WriteRune(m.to[index])
+		case m.delete:
+			/* Characters without a replacement are dropped */
+		default:
+			/* Short replacement lists repeat their last character */
+			ret.WriteRune(m.to[len(m.to)-1])
+		}
+	}
+	return ret.String()
+}
+
+// }}}
+
+// Mangles {{{
+
+// Mangles is a list of rules, applied in order.
+type Mangles []Mangle
+
+// Parse a list of mangle rules, separated by semicolons, as they're given
+// to a debian/watch option.
+func ParseMangles(rules string) (Mangles, error) {
+	ret := Mangles{}
+	for _, rule := range strings.Split(rules, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		mangle, err := ParseMangle(rule)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *mangle)
+	}
+	return ret, nil
+}
+
+// Apply each of the rules to the given string in turn, returning the
+// rewritten string.
+func (m Mangles) Apply(in string) string {
+	for _, mangle := range m {
+		in = mangle.Apply(in)
+	}
+	return in
+}
+
+// }}}
+
+// Perl syntax helpers {{{
+
+var closingDelimiters = map[rune]rune{
+	'{': '}',
+	'(': ')',
+	'[': ']',
+	'<': '>',
+}
+
+// Split the body of a rule (everything after the `s`, `tr` or `y`) into
+// the pattern, the replacement and the flags. The delimiter is the first
+// character of the body; bracketing delimiters (such as `s{a}{b}`) are
+// paired up the same way Perl does.
+func splitMangle(body string) (string, string, string, error) {
+	runes := []rune(body)
+	if len(runes) == 0 {
+		return "", "", "", fmt.Errorf("missing delimiter")
+	}
+	open := runes[0]
+	if unicode.IsLetter(open) || unicode.IsDigit(open) || unicode.IsSpace(open) {
+		return "", "", "", fmt.Errorf("bad delimiter '%c'", open)
+	}
+
+	close, bracketed := closingDelimiters[open]
+	if !bracketed {
+		close = open
+	}
+
+	from, rest, err := readDelimited(runes[1:], open, close, bracketed)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if bracketed {
+		rest = []rune(strings.TrimLeftFunc(string(rest), unicode.IsSpace))
+		if len(rest) == 0 {
+			return "", "", "", fmt.Errorf("missing replacement")
+		}
+		open = rest[0]
+		if close, bracketed = closingDelimiters[open]; !bracketed {
+			return "", "", "", fmt.Errorf("bad delimiter '%c'", open)
+		}
+		rest = rest[1:]
+	}
+
+	to, rest, err := readDelimited(rest, open, close, bracketed)
+	if err != nil {
+		return "", "", "", err
+	}
+	return from, to, string(rest), nil
+}
+
+// Read up to the closing delimiter, returning what was read and what's
+// left after the delimiter. Backslash escapes are kept as-is, except for
+// escaped delimiters, which are unescaped unless they'd mean something
+// else to the regular expression.
+func readDelimited(runes []rune, open, close rune, bracketed bool) (string, []rune, error) {
+	ret := strings.Builder{}
+	depth := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			next := runes[i]
+			if (next == open || next == close) && !strings.ContainsRune(`.+*?()|[]{}^$`, next) {
+				ret.WriteRune(next)
+				continue
+			}
+			ret.WriteRune(r)
+			ret.WriteRune(next)
+		case bracketed && r == open:
+			depth++
+			ret.WriteRune(r)
+		case r == close && depth > 0:
+			depth--
+			ret.WriteRune(r)
+		case r == close:
+			return ret.String(), runes[i+1:], nil
+		default:
+			ret.WriteRune(r)
+		}
+	}
+	return "", nil, fmt.Errorf("missing closing delimiter '%c'", close)
+}
+
+// Convert a Perl replacement string into the template syntax used by
+// regexp.Expand. Perl's `$1`, `${1}`, `\1` and `$&` become `${1}` and
+// `${0}`, backslash escapes are unescaped, and any other `$` is literal.
+func perlReplacement(replacement string) string {
+	ret := strings.Builder{}
+	runes := []rune(replacement)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			switch next := runes[i]; {
+			case unicode.IsDigit(next):
+				fmt.Fprintf(&ret, "${%c}", next)
+			case next == '$':
+				ret.WriteString("$$")
+			default:
+				ret.WriteRune(next)
+			}
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '&':
+			i++
+			ret.WriteString("${0}")
+		case r == '$' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			j := i + 1
+			for j < len(runes) && unicode.IsDigit(runes[j]) {
+				j++
+			}
+			fmt.Fprintf(&ret, "${%s}", string(runes[i+1:j]))
+			i = j - 1
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '{':
+			j := i + 2
+			for j < len(runes) && runes[j] != '}' {
+				j++
+			}
+			if j == len(runes) {
+				ret.WriteString("$$")
+				continue
+			}
+			ret.WriteString(string(runes[i : j+1]))
+			i = j
+		case r == '$':
+			ret.WriteString("$$")
+		default:
+			ret.WriteRune(r)
+		}
+	}
+	return ret.String()
+}
+
+// Expand the ranges (such as `a-z`) in a tr list, returning each of the
+// characters in the list. A `-` at the start or end of the list, or one
+// escaped with a backslash, is literal.
+func expandRanges(list string) []rune {
+	literal := []bool{}
+	runes := []rune{}
+	in := []rune(list)
+	for i := 0; i < len(in); i++ {
+		if in[i] == '\\' && i+1 < len(in) {
+			i++
+			runes = append(runes, unescapeRune(in[i]))
+			literal = append(literal, true)
+			continue
+		}
+		runes = append(runes, in[i])
+		literal = append(literal, false)
+	}
+
+	ret := []rune{}
+	for i := 0; i < len(runes); i++ {
+		if i+2 < len(runes) && runes[i+1] == '-' && !literal[i+1] && runes[i] <= runes[i+2] {
+			for r := runes[i]; r <= runes[i+2]; r++ {
+				ret = append(ret, r)
+			}
+			i += 2
+			continue
+		}
+		ret = append(ret, runes[i])
+	}
+	return ret
+}
+
+func unescapeRune(r rune) rune {
+	switch r {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	default:
+		return r
+	}
+}
+
+// }}}
+
+// vim: foldmethod=marker
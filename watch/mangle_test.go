@@ -0,0 +1,113 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"pault.ag/go/debian/watch"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil && err != io.EOF {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+func mangle(t *testing.T, rule, in string) string {
+	mangles, err := watch.ParseMangles(rule)
+	isok(t, err)
+	return mangles.Apply(in)
+}
+
+func TestSubstituteMangle(t *testing.T) {
+	assert(t, mangle(t, `s/-/./`, "1-2-3") == "1.2-3")
+	assert(t, mangle(t, `s/-/./g`, "1-2-3") == "1.2.3")
+	assert(t, mangle(t, `s/RC/rc/gi`, "1.0Rc1") == "1.0rc1")
+	assert(t, mangle(t, `s/(\d)[_\.\-\+]?((RC|rc|pre|dev|beta|alpha)\d*)$/$1~$2/`,
+		"1.0rc1") == "1.0~rc1")
+	assert(t, mangle(t, `s/(\d+)_(\d+)/\1.\2/`, "1_2") == "1.2")
+	assert(t, mangle(t, `s/^/0./`, "12") == "0.12")
+	assert(t, mangle(t, `s/$/+dfsg/`, "1.0") == "1.0+dfsg")
+	assert(t, mangle(t, `s/(.*)/${1}0/`, "1.") == "1.0")
+	assert(t, mangle(t, `s/x/\$/`, "1x") == "1$")
+	assert(t, mangle(t, `s/x/$&$&/`, "1x") == "1xx")
+	assert(t, mangle(t, `s{\+dfsg}{}`, "1.0+dfsg") == "1.0")
+	assert(t, mangle(t, `s{a}  {b}g`, "aa") == "bb")
+	assert(t, mangle(t, `s|\|x||`, "1|x") == "1")
+	assert(t, mangle(t, `s%\%%-%`, "1%0") == "1-0")
+	assert(t, mangle(t, `s/\//-/g`, "a/b/c") == "a-b-c")
+	assert(t, mangle(t, `s/.*\/v?([\d\.]+)\.tar\.gz/hello-$1.tar.gz/`,
+		"https://example.com/v1.2.tar.gz") == "hello-1.2.tar.gz")
+}
+
+func TestTransliterateMangle(t *testing.T) {
+	assert(t, mangle(t, `tr/A-Z/a-z/`, "1.0RC1") == "1.0rc1")
+	assert(t, mangle(t, `y/_/./`, "1_2_3") == "1.2.3")
+	assert(t, mangle(t, `tr/a-c/x/`, "abcd") == "xxxd")
+	assert(t, mangle(t, `tr/a-c/x/d`, "abcd") == "xd")
+	assert(t, mangle(t, `tr/\-_/../`, "1-2_3") == "1.2.3")
+}
+
+func TestMangles(t *testing.T) {
+	assert(t, mangle(t, `s/_/./g;s/^v//; tr/A-Z/a-z/`, "v1_0_RC1") == "1.0.rc1")
+	assert(t, mangle(t, ``, "1.0") == "1.0")
+
+	_, err := watch.ParseMangle(`s/a/b`)
+	notok(t, err)
+	_, err = watch.ParseMangle(`s/a/b/q`)
+	notok(t, err)
+	_, err = watch.ParseMangle(`s/(?=a)/b/`)
+	notok(t, err)
+	_, err = watch.ParseMangle(`m/a/`)
+	notok(t, err)
+	_, err = watch.ParseMangle(`sabc`)
+	notok(t, err)
+	_, err = watch.ParseMangle(`s{a}/b/`)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
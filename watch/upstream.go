@@ -0,0 +1,139 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch // import "pault.ag/go/debian/watch"
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/version"
+)
+
+// An Upstream is an upstream release which matched an Entry.
+type Upstream struct {
+	// Link to the release, as it was matched.
+	Name string
+
+	// Name to save the release as, after any filenamemangle rules have
+	// been applied. Without any rules, this is the base name of Name.
+	Filename string
+
+	// Upstream version of the release, after any uversionmangle rules
+	// have been applied.
+	Version version.Version
+}
+
+// Return the compiled MatchingPattern of the Entry. As with uscan, the
+// pattern must match the whole of the link, other than any leading
+// directories.
+func (e Entry) Regexp() (*regexp.Regexp, error) {
+	re, err := regexp.Compile(`^(?:.*/)?(?:` + e.MatchingPattern + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	if re.NumSubexp() == 0 {
+		return nil, fmt.Errorf("Matching pattern '%s' has no version group", e.MatchingPattern)
+	}
+	return re, nil
+}
+
+// Match a link to an upstream release against the Entry. If the link
+// matches, the groups of the MatchingPattern are joined with "." and put
+// through the uversionmangle rules to get the upstream version. If the
+// link doesn't match, nil is returned.
+func (e Entry) Match(name string) (*Upstream, error) {
+	re, err := e.Regexp()
+	if err != nil {
+		return nil, err
+	}
+	return e.match(re, name), nil
+}
+
+func (e Entry) match(re *regexp.Regexp, name string) *Upstream {
+	groups := re.FindStringSubmatch(name)
+	if groups == nil {
+		return nil
+	}
+	parts := []string{}
+	for _, group := range groups[1:] {
+		if group != "" {
+			parts = append(parts, group)
+		}
+	}
+
+	filename := path.Base(name)
+	if len(e.FilenameMangle) > 0 {
+		filename = e.FilenameMangle.Apply(name)
+	}
+	return &Upstream{
+		Name:     name,
+		Filename: filename,
+		Version: version.Version{
+			Version: e.UversionMangle.Apply(strings.Join(parts, ".")),
+		},
+	}
+}
+
+// Match each of the links against the Entry, and return the releases
+// which matched, newest first.
+func (e Entry) Upstreams(names []string) ([]Upstream, error) {
+	re, err := e.Regexp()
+	if err != nil {
+		return nil, err
+	}
+	ret := []Upstream{}
+	for _, name := range names {
+		if upstream := e.match(re, name); upstream != nil {
+			ret = append(ret, *upstream)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return version.Compare(ret[i].Version, ret[j].Version) > 0
+	})
+	return ret, nil
+}
+
+// Return the upstream part of the given Debian version, after any
+// dversionmangle rules have been applied, ready to be compared with the
+// version of an Upstream release.
+func (e Entry) DebianVersion(current version.Version) version.Version {
+	return version.Version{Version: e.DversionMangle.Apply(current.Version)}
+}
+
+// Match each of the links against the Entry, and return the newest
+// release, along with whether it's newer than the upstream part of the
+// given Debian version. If none of the links match, nil is returned.
+func (e Entry) Newest(names []string, current version.Version) (*Upstream, bool, error) {
+	upstreams, err := e.Upstreams(names)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(upstreams) == 0 {
+		return nil, false, nil
+	}
+	newest := upstreams[0]
+	return &newest, version.Compare(newest.Version, e.DebianVersion(current)) > 0, nil
+}
+
+// vim: foldmethod=marker
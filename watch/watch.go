@@ -0,0 +1,409 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch // import "pault.ag/go/debian/watch"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"pault.ag/go/debian/control"
+)
+
+// Watch {{{
+
+// A Watch is a parsed debian/watch file, as read by uscan(1). Both the
+// line based version 4 format and the deb822 based version 5 format are
+// supported.
+type Watch struct {
+	Version int
+	Entries []Entry
+}
+
+// An Entry is a single upstream source being watched: a URL to look for
+// releases at, and a pattern matching the releases found there.
+type Entry struct {
+	// Options set on this entry, keyed by lower case option name with any
+	// hyphens removed (so "Uversion-Mangle" and "uversionmangle" are both
+	// stored as "uversionmangle"). Options without a value (such as
+	// "repack") are set to the empty string.
+	Options map[string]string
+
+	// URL of the page or directory to look for upstream releases at.
+	Source string
+
+	// Regular expression matched against the links found at the Source.
+	// The groups of the expression capture the upstream version. Any
+	// uscan placeholders (such as @ANY_VERSION@) have been substituted.
+	MatchingPattern string
+
+	// What to do with the new upstream version, such as "debian",
+	// "same", "previous" or "ignore", or the version to look for.
+	VersionPolicy string
+
+	// Script to run after fetching a new upstream version.
+	Script string
+
+	UversionMangle Mangles
+	DversionMangle Mangles
+	FilenameMangle Mangles
+	PGPMode        string
+}
+
+var pgpModes = map[string]bool{
+	"auto":     true,
+	"default":  true,
+	"mangle":   true,
+	"next":     true,
+	"previous": true,
+	"self":     true,
+	"gittag":   true,
+	"none":     true,
+}
+
+// Set the parsed options of an Entry from its Options, substituting the
+// name of the source package for @PACKAGE@ in any mangle rules.
+func (e *Entry) setOptions(pkg string) error {
+	var err error
+	for _, option := range []struct {
+		name   string
+		target *Mangles
+	}{
+		{"versionmangle", &e.UversionMangle},
+		{"versionmangle", &e.DversionMangle},
+		{"uversionmangle", &e.UversionMangle},
+		{"dversionmangle", &e.DversionMangle},
+		{"filenamemangle", &e.FilenameMangle},
+	} {
+		rules, ok := e.Options[option.name]
+		if !ok {
+			continue
+		}
+		if option.name == "dversionmangle" && rules == "auto" {
+			rules = `s/@DEB_EXT@//`
+		}
+		*option.target, err = ParseMangles(substitute(rules, pkg))
+		if err != nil {
+			return err
+		}
+	}
+
+	e.PGPMode = e.Options["pgpmode"]
+	if e.PGPMode != "" && !pgpModes[e.PGPMode] {
+		return fmt.Errorf("Unknown pgpmode: '%s'", e.PGPMode)
+	}
+	return nil
+}
+
+// Normalize an option name, so that the version 4 and version 5 spellings
+// of the same option are the same.
+func optionName(name string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(name), "-", "", -1))
+}
+
+// }}}
+
+// Placeholders {{{
+
+// Substitutions uscan makes in patterns and mangle rules, so that common
+// patterns don't need to be written out in full.
+var placeholders = []struct {
+	name  string
+	value string
+}{
+	{"@ANY_VERSION@", `[-_]?[Vv]?(\d[\-+\.:\~\da-zA-Z]*)`},
+	{"@SIGNATURE_EXT@", `(?i:\.(?:tar\.xz|tar\.bz2|tar\.gz|tar\.zstd?|zip|tgz|tbz|txz))(?i:\.(?:asc|pgp|gpg|sig|sign))`},
+	{"@ARCHIVE_EXT@", `(?i:\.(?:tar\.xz|tar\.bz2|tar\.gz|tar\.zstd?|zip|tgz|tbz|txz))`},
+	{"@DEB_EXT@", `[\+~](?:debian|dfsg|ds|deb)(?:\.)?(?:\d+)?$`},
+}
+
+// Substitute the uscan placeholders in the given string. The name of the
+// source package is substituted for @PACKAGE@.
+func substitute(in string, pkg string) string {
+	for _, placeholder := range placeholders {
+		in = strings.Replace(in, placeholder.name, placeholder.value, -1)
+	}
+	return strings.Replace(in, "@PACKAGE@", pkg, -1)
+}
+
+// }}}
+
+// Parsing {{{
+
+// Given a path on the filesystem, Parse the debian/watch file off the disk
+// and return a pointer to a brand new Watch struct, unless error is set to
+// a value other than nil. The name of the source package is substituted
+// for @PACKAGE@ in the watch file.
+func ParseFile(path string, pkg string) (*Watch, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f, pkg)
+}
+
+// Given an io.Reader, consume the Reader, and return a Watch object for
+// use. The name of the source package is substituted for @PACKAGE@ in the
+// watch file.
+func Parse(reader io.Reader, pkg string) (*Watch, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(line), "version:") {
+			return parse5(bytes.NewReader(data), pkg)
+		}
+		return parse4(bytes.NewReader(data), pkg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("Empty watch file")
+}
+
+// Parse a version 4 watch file. The first line gives the version of the
+// file, and each following line (which may be continued on to the next
+// line by ending it with a backslash) is an Entry:
+//
+//	opts=<options> <source> <matching pattern> [<version policy> [<script>]]
+func parse4(reader io.Reader, pkg string) (*Watch, error) {
+	lines, err := joinLines(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("Empty watch file")
+	}
+
+	key, value, ok := strings.Cut(lines[0], "=")
+	if !ok || strings.TrimSpace(key) != "version" {
+		return nil, fmt.Errorf("Watch file has no version line")
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("Bad watch file version: '%s'", value)
+	}
+	if version != 4 {
+		return nil, fmt.Errorf("Unsupported watch file version: %d", version)
+	}
+
+	ret := Watch{Version: version, Entries: []Entry{}}
+	for _, line := range lines[1:] {
+		entry, err := parseLine(line, pkg)
+		if err != nil {
+			return nil, err
+		}
+		ret.Entries = append(ret.Entries, *entry)
+	}
+	return &ret, nil
+}
+
+// Read the lines of a version 4 watch file, skipping comments and blank
+// lines, and joining any continued lines.
+func joinLines(reader io.Reader) ([]string, error) {
+	ret := []string{}
+	scanner := bufio.NewScanner(reader)
+	continued := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if continued == "" && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+		if strings.HasSuffix(line, `\`) {
+			continued += strings.TrimSuffix(line, `\`)
+			continue
+		}
+		ret = append(ret, continued+line)
+		continued = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if continued != "" {
+		ret = append(ret, continued)
+	}
+	return ret, nil
+}
+
+// Parse a single (joined) line of a version 4 watch file into an Entry.
+func parseLine(line string, pkg string) (*Entry, error) {
+	entry := Entry{Options: map[string]string{}}
+
+	if strings.HasPrefix(line, "opts=") || strings.HasPrefix(line, "options=") {
+		_, line, _ = strings.Cut(line, "=")
+		var opts string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.Index(line[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated opts in watch line: '%s'", line)
+			}
+			opts, line = line[1:end+1], line[end+2:]
+		} else {
+			opts, line, _ = strings.Cut(line, " ")
+		}
+		for _, option := range splitOptions(opts) {
+			key, value, _ := strings.Cut(option, "=")
+			entry.Options[optionName(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Watch line has no source URL")
+	}
+
+	entry.Source = fields[0]
+	if len(fields) == 1 {
+		/* The pattern may be given as the last part of the URL */
+		index := strings.LastIndex(entry.Source, "/")
+		if index < 0 {
+			return nil, fmt.Errorf("Watch line has no matching pattern: '%s'", line)
+		}
+		entry.Source, fields = entry.Source[:index+1], append(fields, entry.Source[index+1:])
+	}
+	entry.MatchingPattern = substitute(fields[1], pkg)
+	if len(fields) > 2 {
+		entry.VersionPolicy = fields[2]
+	}
+	if len(fields) > 3 {
+		entry.Script = strings.Join(fields[3:], " ")
+	}
+	if entry.VersionPolicy == "" {
+		entry.VersionPolicy = "debian"
+	}
+
+	if err := entry.setOptions(pkg); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Split an opts= list on commas. A comma may be included in an option
+// (such as in a mangle rule) by escaping it with a backslash.
+func splitOptions(opts string) []string {
+	ret := []string{}
+	current := strings.Builder{}
+	for i := 0; i < len(opts); i++ {
+		switch {
+		case opts[i] == '\\' && i+1 < len(opts) && opts[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case opts[i] == ',':
+			ret = append(ret, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(opts[i])
+		}
+	}
+	ret = append(ret, current.String())
+
+	options := []string{}
+	for _, option := range ret {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// Parse a version 5 watch file. The first paragraph gives the version of
+// the file, along with any options which apply to all of the following
+// paragraphs, each of which is an Entry. Options may be given across
+// more than one line, in which case each line is a separate mangle rule.
+func parse5(reader io.Reader, pkg string) (*Watch, error) {
+	paragraphs, err := control.NewParagraphReader(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	all, err := paragraphs.All()
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("Empty watch file")
+	}
+
+	defaults := map[string]string{}
+	for _, key := range all[0].Order {
+		defaults[optionName(key)] = strings.TrimSpace(all[0].Values[key])
+	}
+	version, err := strconv.Atoi(defaults["version"])
+	if err != nil {
+		return nil, fmt.Errorf("Bad watch file version: '%s'", defaults["version"])
+	}
+	if version != 5 {
+		return nil, fmt.Errorf("Unsupported watch file version: %d", version)
+	}
+	delete(defaults, "version")
+
+	ret := Watch{Version: version, Entries: []Entry{}}
+	for _, paragraph := range all[1:] {
+		entry := Entry{Options: map[string]string{}}
+		for key, value := range defaults {
+			entry.Options[key] = value
+		}
+		for _, key := range paragraph.Order {
+			value := strings.TrimSpace(paragraph.Values[key])
+			entry.Options[optionName(key)] = strings.Replace(value, "\n", ";", -1)
+		}
+
+		entry.Source = entry.Options["source"]
+		entry.MatchingPattern = substitute(entry.Options["matchingpattern"], pkg)
+		entry.VersionPolicy = entry.Options["versionschema"]
+		entry.Script = entry.Options["updatescript"]
+		for _, key := range []string{"source", "matchingpattern", "versionschema", "updatescript"} {
+			delete(entry.Options, key)
+		}
+
+		if entry.Source == "" {
+			return nil, fmt.Errorf("Watch paragraph has no Source")
+		}
+		if entry.MatchingPattern == "" {
+			return nil, fmt.Errorf("Watch paragraph has no Matching-Pattern")
+		}
+		if entry.VersionPolicy == "" {
+			entry.VersionPolicy = "debian"
+		}
+
+		if err := entry.setOptions(pkg); err != nil {
+			return nil, err
+		}
+		ret.Entries = append(ret.Entries, entry)
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
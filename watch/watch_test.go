@@ -0,0 +1,176 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch_test
+
+import (
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/version"
+	"pault.ag/go/debian/watch"
+)
+
+/*
+ *
+ */
+
+// Test Watch {{{
+const testWatch4 = `# Watch for new hello releases
+version=4
+
+opts="uversionmangle=s/-?rc/~rc/;s/-/./g, \
+      dversionmangle=auto,pgpmode=auto" \
+  https://example.com/releases/ @PACKAGE@@ANY_VERSION@@ARCHIVE_EXT@ debian uupdate
+
+opts=filenamemangle=s%.*/v?(\d\S+)\.tar\.gz%hello-$1.tar.gz% \
+  https://github.com/example/hello/tags .*/v?(\d\S+)\.tar\.gz
+
+https://example.com/old/hello-(\d+)_(\d+)\.zip
+`
+
+const testWatch5 = `Version: 5
+Dversion-Mangle: auto
+
+Source: https://example.com/releases/
+Matching-Pattern: @PACKAGE@@ANY_VERSION@@ARCHIVE_EXT@
+Uversion-Mangle: s/-?rc/~rc/
+ s/-/./g
+Pgp-Mode: auto
+
+Source: https://github.com/example/hello/tags
+Matching-Pattern: .*/v?(\d\S+)\.tar\.gz
+Version-Schema: same
+Filenamemangle: s%.*/v?(\d\S+)\.tar\.gz%hello-$1.tar.gz%
+`
+
+var testReleases = []string{
+	"hello-1.0.tar.gz",
+	"hello-1.2-rc1.tar.xz",
+	"hello-1.1.tar.gz",
+	"hello-1.1.tar.gz.asc",
+	"goodbye-2.0.tar.gz",
+	"/releases/hello-1.2.tar.bz2",
+}
+
+func checkFirstEntry(t *testing.T, entry watch.Entry) {
+	assert(t, entry.Source == "https://example.com/releases/")
+	assert(t, entry.PGPMode == "auto")
+	assert(t, len(entry.UversionMangle) == 2)
+	assert(t, len(entry.DversionMangle) == 1)
+
+	upstreams, err := entry.Upstreams(testReleases)
+	isok(t, err)
+	assert(t, len(upstreams) == 4)
+	assert(t, upstreams[0].Version.Version == "1.2")
+	assert(t, upstreams[0].Filename == "hello-1.2.tar.bz2")
+	assert(t, upstreams[1].Version.Version == "1.2~rc1")
+	assert(t, upstreams[3].Version.Version == "1.0")
+
+	current, err := version.Parse("1.1+dfsg-2")
+	isok(t, err)
+	assert(t, entry.DebianVersion(current).Version == "1.1")
+
+	newest, newer, err := entry.Newest(testReleases, current)
+	isok(t, err)
+	assert(t, newer)
+	assert(t, newest.Name == "/releases/hello-1.2.tar.bz2")
+
+	current, err = version.Parse("1:1.2+ds1-1")
+	isok(t, err)
+	_, newer, err = entry.Newest(testReleases, current)
+	isok(t, err)
+	assert(t, !newer)
+
+	newest, _, err = entry.Newest([]string{"goodbye-2.0.tar.gz"}, current)
+	isok(t, err)
+	assert(t, newest == nil)
+}
+
+func TestParseWatch4(t *testing.T) {
+	w, err := watch.Parse(strings.NewReader(testWatch4), "hello")
+	isok(t, err)
+	assert(t, w.Version == 4)
+	assert(t, len(w.Entries) == 3)
+
+	checkFirstEntry(t, w.Entries[0])
+	assert(t, w.Entries[0].VersionPolicy == "debian")
+	assert(t, w.Entries[0].Script == "uupdate")
+
+	entry := w.Entries[1]
+	assert(t, entry.Source == "https://github.com/example/hello/tags")
+	assert(t, entry.VersionPolicy == "debian")
+	upstream, err := entry.Match("/example/hello/archive/refs/tags/v2.0.tar.gz")
+	isok(t, err)
+	assert(t, upstream.Version.Version == "2.0")
+	assert(t, upstream.Filename == "hello-2.0.tar.gz")
+
+	entry = w.Entries[2]
+	assert(t, entry.Source == "https://example.com/old/")
+	upstream, err = entry.Match("hello-3_1.zip")
+	isok(t, err)
+	assert(t, upstream.Version.Version == "3.1")
+	upstream, err = entry.Match("hello-3_1.zip.asc")
+	isok(t, err)
+	assert(t, upstream == nil)
+}
+
+func TestParseWatch5(t *testing.T) {
+	w, err := watch.Parse(strings.NewReader(testWatch5), "hello")
+	isok(t, err)
+	assert(t, w.Version == 5)
+	assert(t, len(w.Entries) == 2)
+
+	checkFirstEntry(t, w.Entries[0])
+
+	entry := w.Entries[1]
+	assert(t, entry.VersionPolicy == "same")
+	assert(t, entry.Options["dversionmangle"] == "auto")
+	upstream, err := entry.Match("/example/hello/archive/refs/tags/v2.0.tar.gz")
+	isok(t, err)
+	assert(t, upstream.Filename == "hello-2.0.tar.gz")
+}
+
+func TestParseWatchErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"# Nothing but a comment\n",
+		"version=3\nhttps://example.com/ hello-(.*).tar.gz\n",
+		"https://example.com/ hello-(.*).tar.gz\n",
+		"version=4\nopts=pgpmode=sometimes https://example.com/ hello-(.*).tar.gz\n",
+		"version=4\nopts=uversionmangle=s/a/b https://example.com/ hello-(.*).tar.gz\n",
+		"version=4\nopts=\"pgpmode=auto https://example.com/ hello-(.*).tar.gz\n",
+		"Version: 4\n\nSource: https://example.com/\nMatching-Pattern: hello-(.*).tar.gz\n",
+		"Version: 5\n\nMatching-Pattern: hello-(.*).tar.gz\n",
+		"Version: 5\n\nSource: https://example.com/\n",
+	} {
+		_, err := watch.Parse(strings.NewReader(data), "hello")
+		notok(t, err)
+	}
+
+	w, err := watch.Parse(strings.NewReader("version=4\nhttps://example.com/ hello.tar.gz\n"), "hello")
+	isok(t, err)
+	_, err = w.Entries[0].Match("hello.tar.gz")
+	notok(t, err)
+}
+
+// }}}
+
+// vim: foldmethod=marker